@@ -1,9 +1,12 @@
 package fileops
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func ReadFile(fileloc string) (string, error) {
@@ -24,6 +27,20 @@ func ReadFile(fileloc string) (string, error) {
 	return string(data), nil
 }
 
+// WriteFile creates or replaces the file, readable by its owner only since it may hold
+// the content that was moderated.
+func WriteFile(fileloc string, data []byte) error {
+	if fileloc == "" {
+		return fmt.Errorf("filepath cannot be empty")
+	}
+
+	if err := os.WriteFile(fileloc, data, 0o600); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	return nil
+}
+
 func CheckFile(fileloc string) error {
 	absPath, err := filepath.Abs(fileloc)
 	if err != nil {
@@ -45,3 +62,80 @@ func CheckFile(fileloc string) error {
 
 	return nil
 }
+
+type File struct {
+	Path    string
+	Content string
+}
+
+// ReadFiles reads every file matched by pattern, a glob such as "docs/*.txt" or a directory.
+// Subdirectories are not read.
+func ReadFiles(pattern string) ([]File, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("file pattern cannot be empty")
+	}
+
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file pattern: %w", err)
+	}
+
+	files := make([]File, 0, len(paths))
+	for _, p := range paths {
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			continue
+		}
+
+		content, err := ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, File{Path: p, Content: content})
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match: %s", pattern)
+	}
+
+	return files, nil
+}
+
+// ReadImage reads an image file as a base64 data URL, the form the moderation API accepts
+// local images in.
+func ReadImage(fileloc string) (string, error) {
+	if fileloc == "" {
+		return "", fmt.Errorf("filepath cannot be empty")
+	}
+
+	err := CheckFile(fileloc)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(fileloc)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+
+	dataURL, ok := ImageDataURL(data)
+	if !ok {
+		return "", fmt.Errorf("not an image: %s (%s)", fileloc, http.DetectContentType(data))
+	}
+
+	return dataURL, nil
+}
+
+// ImageDataURL encodes data as a base64 data URL when it is an image.
+func ImageDataURL(data []byte) (string, bool) {
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", false
+	}
+
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), true
+}
@@ -3,14 +3,16 @@ module content-moderator
 go 1.24.1
 
 require (
+	github.com/PuerkitoBio/goquery v1.10.2
 	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/gocolly/colly/v2 v2.2.0
 	github.com/openai/openai-go v0.1.0-beta.3
 	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
+	readability v0.0.0
 )
 
 require (
-	github.com/PuerkitoBio/goquery v1.10.2 // indirect
 	github.com/andybalholm/cascadia v1.3.3 // indirect
 	github.com/antchfx/htmlquery v1.3.4 // indirect
 	github.com/antchfx/xmlquery v1.4.4 // indirect
@@ -33,3 +35,5 @@ require (
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+replace readability => ../readability
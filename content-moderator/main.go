@@ -2,21 +2,33 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/caarlos0/env"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/packages/param"
 	"github.com/pkg/errors"
 
 	"content-moderator/fileops"
+	"content-moderator/moderation"
+	"content-moderator/moderator"
 	openaipkg "content-moderator/openai"
+	"content-moderator/policy"
+	"content-moderator/rules"
 	"content-moderator/scraper"
+	"content-moderator/server"
+	"content-moderator/watch"
 )
 
 type envvars struct {
-	OpenApiKey string `env:"OPEN_API_KEY"`
+	OpenApiKey    string `env:"OPEN_API_KEY"`
+	WebhookSecret string `env:"MODERATOR_WEBHOOK_SECRET"`
 }
 
 type ContentTypes string
@@ -26,6 +38,10 @@ const (
 	MultiLineText  ContentTypes = "multi_line_text"
 	TextFromURL    ContentTypes = "text_from_url"
 	TextFromFile   ContentTypes = "text_from_file"
+	Batch          ContentTypes = "batch"
+	ImageFromFile  ContentTypes = "image_from_file"
+	ImageFromURL   ContentTypes = "image_from_url"
+	Crawl          ContentTypes = "crawl"
 )
 
 func main() {
@@ -37,9 +53,28 @@ func main() {
 	}
 
 	contentFlag := flag.String("content", "", "pass in relevant content to check if it is safe or not")
-	typeFlag := flag.String("type", "single_line_text", "Allowed values: single_line_text, multi_line_text, text_from_url, text_from_file. Default: single_line_text")
+	typeFlag := flag.String("type", "single_line_text", "Allowed values: single_line_text, multi_line_text, text_from_url, text_from_file, batch, image_from_file, image_from_url, crawl. Default: single_line_text")
 	urlLinkFlag := flag.String("url", "", "pass in the url to check if the content is safe or not")
-	fileLocFlag := flag.String("file", "", "pass in the file location to check if the content is safe or not")
+	fileLocFlag := flag.String("file", "", "pass in the file location to check if the content is safe or not, for batch a directory or glob pattern of files")
+	maxImagesFlag := flag.Int("max-images", 10, "maximum number of images moderated from a scraped page, 0 skips them")
+	maxDepthFlag := flag.Int("max-depth", 2, "number of links followed from the start page when crawling")
+	maxPagesFlag := flag.Int("max-pages", 100, "maximum number of pages visited when crawling, 0 doesn't limit them")
+	parallelismFlag := flag.Int("parallelism", 2, "number of pages fetched at the same time when crawling")
+	delayFlag := flag.Duration("delay", time.Second, "delay between requests to the same domain when crawling")
+	domainsFlag := flag.String("domains", "", "comma separated domains the crawl stays within, defaults to the domain of the url")
+	ignoreRobotsFlag := flag.Bool("ignore-robots", false, "crawl pages disallowed by the site's robots.txt")
+	policyFlag := flag.String("policy", "", fmt.Sprintf("name of a built-in policy profile (%s) or path to a YAML profile, applied to the moderation scores", strings.Join(policy.Builtin(), ", ")))
+	rulesFlag := flag.String("rules", "default", fmt.Sprintf("name of built-in local rules (%s) or path to a YAML rules file, checked before the moderation API, off disables them", strings.Join(rules.Builtin(), ", ")))
+	redactFlag := flag.Bool("redact", false, "write the content with flagged sentences and local rule matches, e.g. PII with -rules=pii, replaced by category tokens instead of the report, for single_line_text, text_from_file and text_from_url")
+	redactOutFlag := flag.String("redact-out", "", "file the redacted content is written to, defaults to stdout")
+	redactMapFlag := flag.String("redact-map", "", "JSON file the redactions are written to, with the replaced text")
+	watchFlag := flag.String("watch", "", "file listing URLs, one per line, to re-moderate on a schedule instead of moderating once")
+	watchStateFlag := flag.String("watch-state", "watch-state.json", "file the text, hashes and findings of watched pages are kept in")
+	intervalFlag := flag.Duration("interval", time.Hour, "time between checks of the watched URLs, 0 checks them once")
+	watchWebhookFlag := flag.String("watch-webhook", "", "URL the newly flagged content of watched pages is posted to")
+	serveFlag := flag.Bool("serve", false, "serve the HTTP moderation API instead of moderating once")
+	addrFlag := flag.String("addr", ":8080", "address the server listens on")
+	auditLogFlag := flag.String("audit-log", "audit.jsonl", "JSONL file the server appends every decision to, empty disables it")
 	flag.Parse()
 
 	content := ""
@@ -58,6 +93,14 @@ func main() {
 			typeOfContent = TextFromURL
 		case string(TextFromFile):
 			typeOfContent = TextFromFile
+		case string(Batch):
+			typeOfContent = Batch
+		case string(ImageFromFile):
+			typeOfContent = ImageFromFile
+		case string(ImageFromURL):
+			typeOfContent = ImageFromURL
+		case string(Crawl):
+			typeOfContent = Crawl
 		default:
 			log.Fatalln("invalid content type provided")
 		}
@@ -73,115 +116,331 @@ func main() {
 		fileLoc = *fileLocFlag
 	}
 
-	openaiClient := openaipkg.NewOpenAiClient(envs.OpenApiKey)
-
-	// TODO: Add support for multiple results
-	resultLookupIndex := -1
-	var inputContent openai.ModerationNewParamsInputUnion
+	maxImages := 10
+	if maxImagesFlag != nil {
+		maxImages = *maxImagesFlag
+	}
 
-	switch typeOfContent {
-	case SingleLineText:
-		resultLookupIndex = 0
+	crawlOpts := scraper.CrawlOptions{
+		MaxDepth:    2,
+		MaxPages:    100,
+		Parallelism: 2,
+		Delay:       time.Second,
+	}
+	if maxDepthFlag != nil {
+		crawlOpts.MaxDepth = *maxDepthFlag
+	}
+	if maxPagesFlag != nil {
+		crawlOpts.MaxPages = *maxPagesFlag
+	}
+	if parallelismFlag != nil {
+		crawlOpts.Parallelism = *parallelismFlag
+	}
+	if delayFlag != nil {
+		crawlOpts.Delay = *delayFlag
+	}
+	if crawlOpts.MaxDepth < 0 || crawlOpts.MaxPages < 0 || crawlOpts.Parallelism < 0 || crawlOpts.Delay < 0 {
+		log.Fatalln("-max-depth, -max-pages, -parallelism and -delay cannot be negative")
+	}
+	if domainsFlag != nil && *domainsFlag != "" {
+		for _, domain := range strings.Split(*domainsFlag, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				crawlOpts.AllowedDomains = append(crawlOpts.AllowedDomains, domain)
+			}
+		}
+	}
+	if ignoreRobotsFlag != nil {
+		crawlOpts.IgnoreRobotsTxt = *ignoreRobotsFlag
+	}
 
-		inputContent = openai.ModerationNewParamsInputUnion{
-			OfString: param.NewOpt(content),
+	var profile *policy.Profile
+	if policyFlag != nil && *policyFlag != "" {
+		var err error
+		profile, err = policy.Load(*policyFlag)
+		if err != nil {
+			log.Fatalln("failed to load policy:", err)
 		}
+	}
 
-	case TextFromURL:
-		content, err := scraper.ScrapeURL(urlLink)
+	checker := moderator.Checker{
+		Client:  openaipkg.NewOpenAiClient(envs.OpenApiKey),
+		Offline: envs.OpenApiKey == "",
+		Policy:  profile,
+	}
+
+	if rulesFlag != nil && *rulesFlag != "" && *rulesFlag != "off" {
+		var err error
+		checker.Rules, err = rules.Load(*rulesFlag)
 		if err != nil {
-			log.Fatalln("failed to scrape URL:", err)
+			log.Fatalln("failed to load rules:", err)
 		}
+	}
 
-		resultLookupIndex = 0
-		inputContent = openai.ModerationNewParamsInputUnion{
-			OfString: param.NewOpt(content),
+	if checker.Offline {
+		if checker.Rules == nil {
+			log.Fatalln("OPEN_API_KEY is not set and local rules are off, nothing to moderate with")
 		}
 
-	case TextFromFile:
-		content, err := fileops.ReadFile(fileLoc)
-		if err != nil {
-			log.Fatalln("failed to scrape URL:", err)
+		log.Println("OPEN_API_KEY is not set, moderating offline with the local rules only")
+	}
+
+	if serveFlag != nil && *serveFlag {
+		addr := ":8080"
+		if addrFlag != nil {
+			addr = *addrFlag
 		}
 
-		resultLookupIndex = 0
-		inputContent = openai.ModerationNewParamsInputUnion{
-			OfString: param.NewOpt(content),
+		auditLog := "audit.jsonl"
+		if auditLogFlag != nil {
+			auditLog = *auditLogFlag
 		}
+
+		serve(server.Config{
+			Addr:          addr,
+			Policy:        profile,
+			AuditLog:      auditLog,
+			WebhookSecret: envs.WebhookSecret,
+			MaxImages:     maxImages,
+		}, checker)
+		return
 	}
 
-	res, err := openaiClient.Moderations.New(ctx, openai.ModerationNewParams{
-		Input: inputContent,
-	})
-	if err != nil {
-		log.Fatalln("failed to check content moderation:", err)
+	redact := redactFlag != nil && *redactFlag
+	if redact {
+		switch typeOfContent {
+		case SingleLineText, TextFromFile, TextFromURL:
+		default:
+			log.Fatalln("-redact supports single_line_text, text_from_file and text_from_url only")
+		}
+
+		// Images can't be redacted, so they aren't moderated either.
+		maxImages = 0
 	}
 
-	if res.Results[resultLookupIndex].Flagged {
-		cats := getFlaggedCategories(res, resultLookupIndex)
-		log.Println("Your content is flagged as unsafe in categories:", cats)
-	} else {
-		log.Println("Your content is safe")
+	if watchFlag != nil && *watchFlag != "" {
+		cfg := watch.Config{
+			ListFile:      *watchFlag,
+			StateFile:     "watch-state.json",
+			Interval:      time.Hour,
+			WebhookSecret: envs.WebhookSecret,
+			Policy:        profile,
+		}
+		if watchStateFlag != nil {
+			cfg.StateFile = *watchStateFlag
+		}
+		if intervalFlag != nil {
+			cfg.Interval = *intervalFlag
+		}
+		if watchWebhookFlag != nil {
+			cfg.WebhookURL = *watchWebhookFlag
+		}
+
+		watchURLs(cfg, checker)
+		return
 	}
-}
 
-func getFlaggedCategories(
-	res *openai.ModerationNewResponse,
-	resultLookupIndex int,
-) []string {
-	cats := make([]string, 0)
+	var in moderator.Input
+	var pages []scraper.Page
+	var err error
 
-	if res.Results[resultLookupIndex].Categories.Harassment {
-		cats = append(cats, "Harassment")
+	switch typeOfContent {
+	case SingleLineText:
+		in = moderator.FromText(content)
+
+	case MultiLineText:
+		in = moderator.FromLines(content)
+		if in.Empty() {
+			log.Fatalln("content cannot be empty for multi-line text")
+		}
+
+	case TextFromURL:
+		in, err = moderator.FromURL(urlLink, maxImages, nil)
+
+	case TextFromFile:
+		in, err = moderator.FromFile(fileLoc)
+
+	case Batch:
+		in, err = moderator.FromFiles(fileLoc)
+
+	case ImageFromFile:
+		in, err = moderator.FromImageFile(fileLoc)
+
+	case ImageFromURL:
+		if urlLink == "" {
+			log.Fatalln("url cannot be empty for image moderation")
+		}
+
+		in = moderator.FromImage(urlLink, urlLink)
+
+	case Crawl:
+		in, pages, err = moderator.FromCrawl(urlLink, crawlOpts)
+		if err == nil {
+			log.Printf("Crawled %d pages, moderating %d chunks\n", len(pages), len(in.Items))
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.HarassmentThreatening {
-		cats = append(cats, "Harassment Threatening")
+	results, err := checker.Run(ctx, in)
+	if err != nil {
+		log.Fatalln("failed to check content moderation:", err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.Hate {
-		cats = append(cats, "Hate")
+	if redact {
+		redactOut, redactMap := "", ""
+		if redactOutFlag != nil {
+			redactOut = *redactOutFlag
+		}
+		if redactMapFlag != nil {
+			redactMap = *redactMapFlag
+		}
+
+		writeRedacted(in, results, profile, redactOut, redactMap)
+		return
 	}
 
-	if res.Results[resultLookupIndex].Categories.HateThreatening {
-		cats = append(cats, "Hate Threatening")
+	switch typeOfContent {
+	case SingleLineText:
+		if results[0].Flagged {
+			log.Println("Your content is flagged as unsafe in categories:", results[0].AllCategories())
+		} else {
+			log.Println("Your content is safe")
+		}
+
+	case MultiLineText:
+		if err := moderation.WriteTable(os.Stdout, results); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
+
+	case TextFromURL, TextFromFile, ImageFromFile, ImageFromURL:
+		if err := moderation.WriteSpans(os.Stdout, results); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
+
+	case Batch:
+		if err := moderation.WriteTable(os.Stdout, moderation.Merge(results)); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
+
+		fmt.Println()
+		if err := moderation.WriteSpans(os.Stdout, results); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
+
+	case Crawl:
+		if err := moderator.WriteSiteReport(os.Stdout, moderator.SiteReport(pages, results, profile)); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
+
+		fmt.Println()
+		if err := moderation.WriteSpans(os.Stdout, results); err != nil {
+			log.Fatalln("failed to write results:", err)
+		}
 	}
 
-	if res.Results[resultLookupIndex].Categories.SelfHarm {
-		cats = append(cats, "Self Harm")
+	if profile != nil {
+		os.Exit(applyPolicy(profile, results))
 	}
+}
 
-	if res.Results[resultLookupIndex].Categories.SelfHarmInstructions {
-		cats = append(cats, "Self Harm Instructions")
+func serve(cfg server.Config, checker moderator.Checker) {
+	ctx, cancel := shutdownContext()
+	defer cancel()
+
+	srv, err := server.New(checker, cfg)
+	if err != nil {
+		log.Fatalln("failed to create server", err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.SelfHarmIntent {
-		cats = append(cats, "Self Harm Intent")
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalln("failed to run server", err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.Sexual {
-		cats = append(cats, "Sexual")
+	log.Println("Content moderator server stopped.")
+}
+
+func watchURLs(cfg watch.Config, checker moderator.Checker) {
+	ctx, cancel := shutdownContext()
+	defer cancel()
+
+	if err := watch.New(checker, cfg, os.Stdout).Run(ctx); err != nil {
+		log.Fatalln("failed to watch URLs", err)
 	}
+}
+
+// shutdownContext is cancelled on SIGINT or SIGTERM.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		log.Printf("Received signal: %s\n", sig)
+		log.Println("Initiating graceful shutdown...")
+		cancel()
+	}()
 
-	if res.Results[resultLookupIndex].Categories.SexualMinors {
-		cats = append(cats, "Sexual Minors")
+	return ctx, cancel
+}
+
+// writeRedacted writes the redacted content to out, or stdout when it's empty, and the
+// redactions to mapFile when set. The list of tokens goes to stderr, apart from the content.
+func writeRedacted(
+	in moderator.Input,
+	results []moderation.Result,
+	profile *policy.Profile,
+	out string,
+	mapFile string,
+) {
+	redacted, err := moderator.Redact(in, results, profile)
+	if err != nil {
+		log.Fatalln("failed to redact content:", err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.Violence {
-		cats = append(cats, "Violence")
+	if out == "" {
+		fmt.Print(redacted[0].Text)
+		if !strings.HasSuffix(redacted[0].Text, "\n") {
+			fmt.Println()
+		}
+	} else if err := fileops.WriteFile(out, []byte(redacted[0].Text)); err != nil {
+		log.Fatalln("failed to write redacted content:", err)
 	}
 
-	if res.Results[resultLookupIndex].Categories.ViolenceGraphic {
-		cats = append(cats, "Violence Graphic")
+	if mapFile != "" {
+		data, err := json.MarshalIndent(redacted[0], "", "  ")
+		if err != nil {
+			log.Fatalln("failed to encode redactions:", err)
+		}
+
+		if err := fileops.WriteFile(mapFile, data); err != nil {
+			log.Fatalln("failed to write redactions:", err)
+		}
 	}
 
-	if res.Results[resultLookupIndex].Categories.Illicit {
-		cats = append(cats, "Illicit")
+	if err := moderator.WriteRedactions(os.Stderr, redacted); err != nil {
+		log.Fatalln("failed to write redactions:", err)
 	}
+}
 
-	if res.Results[resultLookupIndex].Categories.IllicitViolent {
-		cats = append(cats, "Illicit Violent")
+// applyPolicy prints the profile's decision on the results and returns the exit code for it:
+// 0 to allow, 2 to review and 3 to block the content.
+func applyPolicy(profile *policy.Profile, results []moderation.Result) int {
+	decision := profile.DecideAll(results)
+
+	fmt.Printf("\nPolicy %s: %s\n", profile.Name, strings.ToUpper(string(decision.Action)))
+	for _, reason := range decision.Reasons {
+		fmt.Printf("  - %s\n", reason)
 	}
 
-	return cats
+	switch decision.Action {
+	case policy.Block:
+		return 3
+	case policy.Review:
+		return 2
+	default:
+		return 0
+	}
 }
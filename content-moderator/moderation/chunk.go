@@ -0,0 +1,201 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxChunkLength is the maximum number of characters moderated as one input. It keeps every
+// input well within the API's limits, and a flagged chunk small enough to find the problem in.
+const MaxChunkLength = 2000
+
+// Location points at the part of a document an input was taken from. Line and Column are
+// 1-based, Start and End are character offsets into the document.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+}
+
+type span struct {
+	start int
+	end   int
+}
+
+// boundaries are tried in order until every piece fits, so chunks end at paragraphs
+// where possible, then at sentences or lines, then at words.
+var boundaries = []func(runes []rune, i int) bool{
+	func(runes []rune, i int) bool {
+		if runes[i-1] != '\n' {
+			return false
+		}
+
+		for j := i - 2; j >= 0; j-- {
+			if runes[j] == '\n' {
+				return true
+			}
+
+			if !unicode.IsSpace(runes[j]) {
+				return false
+			}
+		}
+
+		return false
+	},
+	func(runes []rune, i int) bool {
+		return runes[i-1] == '\n' || (strings.ContainsRune(".!?", runes[i-1]) && unicode.IsSpace(runes[i]))
+	},
+	func(runes []rune, i int) bool {
+		return unicode.IsSpace(runes[i-1])
+	},
+}
+
+// Split cuts content into chunks of at most maxLength characters aligned to paragraphs
+// or sentences, and returns one item per chunk with its location in content.
+func Split(name, content string, maxLength int) []Item {
+	runes := []rune(content)
+
+	items := make([]Item, 0)
+	for _, s := range split(runes, span{0, len(runes)}, 0, maxLength) {
+		for s.start < s.end && unicode.IsSpace(runes[s.start]) {
+			s.start++
+		}
+
+		for s.end > s.start && unicode.IsSpace(runes[s.end-1]) {
+			s.end--
+		}
+
+		if s.start == s.end {
+			continue
+		}
+
+		line, column := Position(runes, s.start)
+		items = append(items, Item{
+			Name:    name,
+			Content: string(runes[s.start:s.end]),
+			Location: &Location{
+				Line:   line,
+				Column: column,
+				Start:  s.start,
+				End:    s.end,
+			},
+		})
+	}
+
+	return items
+}
+
+// Sentences cuts a chunk into its sentences and lines, without merging them, so that a flagged
+// chunk can be narrowed down. Their locations are in the document of the chunk.
+func Sentences(item Item) []Item {
+	runes := []rune(item.Content)
+
+	base := Location{Line: 1, Column: 1, Start: 0, End: len(runes)}
+	if item.Location != nil {
+		base = *item.Location
+	}
+
+	parts := make([]span, 0)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if boundaries[1](runes, i) {
+			parts = append(parts, span{start, i})
+			start = i
+		}
+	}
+	parts = append(parts, span{start, len(runes)})
+
+	items := make([]Item, 0, len(parts))
+	for _, s := range parts {
+		for s.start < s.end && unicode.IsSpace(runes[s.start]) {
+			s.start++
+		}
+
+		for s.end > s.start && unicode.IsSpace(runes[s.end-1]) {
+			s.end--
+		}
+
+		if s.start == s.end {
+			continue
+		}
+
+		line, column := Position(runes, s.start)
+		if line == 1 {
+			column += base.Column - 1
+		}
+
+		items = append(items, Item{
+			Name:    item.Name,
+			Content: string(runes[s.start:s.end]),
+			Location: &Location{
+				Line:   base.Line + line - 1,
+				Column: column,
+				Start:  base.Start + s.start,
+				End:    base.Start + s.end,
+			},
+		})
+	}
+
+	return items
+}
+
+func split(runes []rune, s span, level, maxLength int) []span {
+	if s.end-s.start <= maxLength {
+		return []span{s}
+	}
+
+	if level == len(boundaries) {
+		pieces := make([]span, 0)
+		for start := s.start; start < s.end; start += maxLength {
+			pieces = append(pieces, span{start, min(start+maxLength, s.end)})
+		}
+
+		return pieces
+	}
+
+	parts := make([]span, 0)
+	start := s.start
+	for i := s.start + 1; i < s.end; i++ {
+		if boundaries[level](runes, i) {
+			parts = append(parts, span{start, i})
+			start = i
+		}
+	}
+	parts = append(parts, span{start, s.end})
+
+	pieces := make([]span, 0, len(parts))
+	for _, p := range parts {
+		pieces = append(pieces, split(runes, p, level+1, maxLength)...)
+	}
+
+	// Merge neighbours back together as long as they fit, to keep the number of inputs low.
+	merged := []span{pieces[0]}
+	for _, p := range pieces[1:] {
+		last := &merged[len(merged)-1]
+		if p.end-last.start <= maxLength {
+			last.end = p.end
+			continue
+		}
+
+		merged = append(merged, p)
+	}
+
+	return merged
+}
+
+// Position returns the 1-based line and column of the character at offset.
+func Position(runes []rune, offset int) (int, int) {
+	line, column := 1, 1
+	for _, r := range runes[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+			continue
+		}
+
+		column++
+	}
+
+	return line, column
+}
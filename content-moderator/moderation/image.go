@@ -0,0 +1,54 @@
+package moderation
+
+import (
+	"context"
+
+	"github.com/openai/openai-go"
+	"github.com/pkg/errors"
+)
+
+// ImageModel is the moderation model that accepts images, text-only models reject them.
+const ImageModel = openai.ModerationModelOmniModerationLatest
+
+// ModerateImage checks one image, given by URL or as a base64 data URL. The API takes
+// a single image per request, so images are not batched like text.
+func ModerateImage(
+	ctx context.Context,
+	openaiClient openai.Client,
+	name string,
+	imageURL string,
+) (Result, error) {
+	res, err := openaiClient.Moderations.New(ctx, openai.ModerationNewParams{
+		Model: ImageModel,
+		Input: openai.ModerationNewParamsInputUnion{
+			OfModerationMultiModalArray: []openai.ModerationMultiModalInputUnionParam{
+				{
+					OfImageURL: &openai.ModerationImageURLInputParam{
+						ImageURL: openai.ModerationImageURLInputImageURLParam{
+							URL: imageURL,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "failed to check image moderation of %s", name)
+	}
+
+	if res == nil || len(res.Results) == 0 {
+		return Result{}, errors.Errorf("moderation returned no result for image %s", name)
+	}
+
+	m := res.Results[0]
+
+	return Result{
+		Name:       name,
+		Input:      imageURL,
+		Flagged:    m.Flagged,
+		Categories: FlaggedCategories(m),
+		Scores:     CategoryScores(m),
+		Image:      true,
+		InputTypes: AppliedInputTypes(m),
+	}, nil
+}
@@ -0,0 +1,95 @@
+package moderation
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match is a finding of the local rules. Start and End are character offsets into the input.
+type Match struct {
+	Category string `json:"category"`
+	// Rule is the kind of rule that matched: pii, word, pattern or domain.
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+// Label names the category of the match in reports, e.g. "Blocked Domain" for "blocked-domain".
+func (m Match) Label() string {
+	words := strings.FieldsFunc(m.Category, func(r rune) bool {
+		return r == '-' || r == '_' || r == '/' || unicode.IsSpace(r)
+	})
+
+	for i, w := range words {
+		first, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(first)) + w[size:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// AddMatches adds the findings of the local rules to the result, and flags it unless their
+// rules allow the content. Their categories are kept out of Categories and Scores, which
+// only hold the API's verdict, so that a rule can't stand in for an API score.
+func (r *Result) AddMatches(matches []Match) {
+	for _, m := range matches {
+		r.Matches = append(r.Matches, m)
+
+		if m.Action != "allow" {
+			r.Flagged = true
+		}
+	}
+}
+
+// AllCategories returns the categories flagged by the API followed by those of the local
+// rules' flagging matches, for reports.
+func (r Result) AllCategories() []string {
+	categories := slices.Clone(r.Categories)
+	if categories == nil {
+		categories = make([]string, 0)
+	}
+
+	for _, label := range matchLabels(r) {
+		if !slices.Contains(categories, label) {
+			categories = append(categories, label)
+		}
+	}
+
+	return categories
+}
+
+// matchCounts counts the flagging matches of the local rules per category label.
+func (r Result) matchCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, m := range r.Matches {
+		if m.Action != "allow" {
+			counts[m.Label()]++
+		}
+	}
+
+	return counts
+}
+
+// matchLabels returns the categories of the flagging matches of r, in order.
+func matchLabels(r Result) []string {
+	labels := make([]string, 0)
+	for _, m := range r.Matches {
+		if m.Action != "allow" && !slices.Contains(labels, m.Label()) {
+			labels = append(labels, m.Label())
+		}
+	}
+
+	return labels
+}
+
+func describeMatches(n int) string {
+	if n == 1 {
+		return "local rule"
+	}
+
+	return fmt.Sprintf("local rule, %d matches", n)
+}
@@ -0,0 +1,256 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/openai/openai-go"
+	"github.com/pkg/errors"
+)
+
+// BatchSize is the number of inputs sent per moderation request.
+const BatchSize = 32
+
+// Categories maps the API's category names to the names shown in reports.
+var Categories = map[string]string{
+	"harassment":             "Harassment",
+	"harassment/threatening": "Harassment Threatening",
+	"hate":                   "Hate",
+	"hate/threatening":       "Hate Threatening",
+	"self-harm":              "Self Harm",
+	"self-harm/instructions": "Self Harm Instructions",
+	"self-harm/intent":       "Self Harm Intent",
+	"sexual":                 "Sexual",
+	"sexual/minors":          "Sexual Minors",
+	"violence":               "Violence",
+	"violence/graphic":       "Violence Graphic",
+	"illicit":                "Illicit",
+	"illicit/violent":        "Illicit Violent",
+}
+
+type Result struct {
+	// Name identifies the input in reports, e.g. "line 3" or a file name.
+	Name       string    `json:"name"`
+	Input      string    `json:"-"`
+	Location   *Location `json:"location,omitempty"`
+	Flagged    bool      `json:"flagged"`
+	Categories []string  `json:"categories"`
+	// Scores holds the API's score of every category, flagged or not. Like Categories it
+	// only holds the API's verdict, the local rules' findings are in Matches.
+	Scores map[string]float64 `json:"scores"`
+	// Image is set for results of an image, Input then holds its URL.
+	Image bool `json:"image,omitempty"`
+	// Page is the URL of the page an image was found on.
+	Page string `json:"page,omitempty"`
+	// InputTypes holds the input types, "text" or "image", each flagged category applied to.
+	InputTypes map[string][]string `json:"input_types,omitempty"`
+	// Matches holds the findings of the local rules.
+	Matches []Match `json:"matches,omitempty"`
+	// Local is set when only the local rules checked the input, without the moderation API.
+	Local bool `json:"local,omitempty"`
+	// Sentences holds the flagged sentences of a flagged chunk, moderated one by one. It is
+	// empty when the chunk is a single sentence, or is only flagged as a whole.
+	Sentences []Result `json:"sentences,omitempty"`
+}
+
+type Item struct {
+	Name    string
+	Content string
+	// Location is set for chunks of a longer document.
+	Location *Location
+}
+
+// Moderate checks every item and returns one result per item, in order. Items are sent as
+// arrays of inputs, so a batch costs one request per BatchSize items.
+func Moderate(
+	ctx context.Context,
+	openaiClient openai.Client,
+	items []Item,
+) ([]Result, error) {
+	results := make([]Result, 0, len(items))
+
+	for start := 0; start < len(items); start += BatchSize {
+		batch := items[start:min(start+BatchSize, len(items))]
+
+		inputs := make([]string, len(batch))
+		for i, item := range batch {
+			inputs[i] = item.Content
+		}
+
+		res, err := openaiClient.Moderations.New(ctx, openai.ModerationNewParams{
+			Input: openai.ModerationNewParamsInputUnion{
+				OfModerationNewsInputArray: inputs,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to check content moderation")
+		}
+
+		if res == nil || len(res.Results) != len(batch) {
+			return nil, errors.New("moderation did not return a result for every input")
+		}
+
+		for i, m := range res.Results {
+			results = append(results, Result{
+				Name:       batch[i].Name,
+				Input:      batch[i].Content,
+				Location:   batch[i].Location,
+				Flagged:    m.Flagged,
+				Categories: FlaggedCategories(m),
+				Scores:     CategoryScores(m),
+				InputTypes: AppliedInputTypes(m),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// Label names the result in reports, with the line and column of chunks.
+func (r Result) Label() string {
+	if r.Location == nil {
+		return r.Name
+	}
+
+	return fmt.Sprintf("%s:%d:%d", r.Name, r.Location.Line, r.Location.Column)
+}
+
+// Merge combines the results of the chunks of each document into one result per document.
+// A document is flagged when any of its chunks is, and scores are the highest of its chunks.
+func Merge(results []Result) []Result {
+	merged := make([]Result, 0)
+	index := make(map[string]int)
+
+	for _, r := range results {
+		i, ok := index[r.Name]
+		if !ok {
+			index[r.Name] = len(merged)
+			merged = append(merged, Result{
+				Name:   r.Name,
+				Input:  r.Input,
+				Scores: make(map[string]float64),
+			})
+			i = len(merged) - 1
+		}
+
+		m := &merged[i]
+		m.Flagged = m.Flagged || r.Flagged
+
+		for _, c := range r.Categories {
+			if !slices.Contains(m.Categories, c) {
+				m.Categories = append(m.Categories, c)
+			}
+		}
+
+		for c, score := range r.Scores {
+			m.Scores[c] = max(m.Scores[c], score)
+		}
+
+		m.Matches = append(m.Matches, r.Matches...)
+	}
+
+	return merged
+}
+
+func FlaggedCategories(m openai.Moderation) []string {
+	cats := make([]string, 0)
+
+	if m.Categories.Harassment {
+		cats = append(cats, "Harassment")
+	}
+
+	if m.Categories.HarassmentThreatening {
+		cats = append(cats, "Harassment Threatening")
+	}
+
+	if m.Categories.Hate {
+		cats = append(cats, "Hate")
+	}
+
+	if m.Categories.HateThreatening {
+		cats = append(cats, "Hate Threatening")
+	}
+
+	if m.Categories.SelfHarm {
+		cats = append(cats, "Self Harm")
+	}
+
+	if m.Categories.SelfHarmInstructions {
+		cats = append(cats, "Self Harm Instructions")
+	}
+
+	if m.Categories.SelfHarmIntent {
+		cats = append(cats, "Self Harm Intent")
+	}
+
+	if m.Categories.Sexual {
+		cats = append(cats, "Sexual")
+	}
+
+	if m.Categories.SexualMinors {
+		cats = append(cats, "Sexual Minors")
+	}
+
+	if m.Categories.Violence {
+		cats = append(cats, "Violence")
+	}
+
+	if m.Categories.ViolenceGraphic {
+		cats = append(cats, "Violence Graphic")
+	}
+
+	if m.Categories.Illicit {
+		cats = append(cats, "Illicit")
+	}
+
+	if m.Categories.IllicitViolent {
+		cats = append(cats, "Illicit Violent")
+	}
+
+	return cats
+}
+
+func CategoryScores(m openai.Moderation) map[string]float64 {
+	return map[string]float64{
+		"Harassment":             m.CategoryScores.Harassment,
+		"Harassment Threatening": m.CategoryScores.HarassmentThreatening,
+		"Hate":                   m.CategoryScores.Hate,
+		"Hate Threatening":       m.CategoryScores.HateThreatening,
+		"Self Harm":              m.CategoryScores.SelfHarm,
+		"Self Harm Instructions": m.CategoryScores.SelfHarmInstructions,
+		"Self Harm Intent":       m.CategoryScores.SelfHarmIntent,
+		"Sexual":                 m.CategoryScores.Sexual,
+		"Sexual Minors":          m.CategoryScores.SexualMinors,
+		"Violence":               m.CategoryScores.Violence,
+		"Violence Graphic":       m.CategoryScores.ViolenceGraphic,
+		"Illicit":                m.CategoryScores.Illicit,
+		"Illicit Violent":        m.CategoryScores.IllicitViolent,
+	}
+}
+
+// AppliedInputTypes returns the input types of the flagged categories.
+func AppliedInputTypes(m openai.Moderation) map[string][]string {
+	all := map[string][]string{
+		"Harassment":             m.CategoryAppliedInputTypes.Harassment,
+		"Harassment Threatening": m.CategoryAppliedInputTypes.HarassmentThreatening,
+		"Hate":                   m.CategoryAppliedInputTypes.Hate,
+		"Hate Threatening":       m.CategoryAppliedInputTypes.HateThreatening,
+		"Self Harm":              m.CategoryAppliedInputTypes.SelfHarm,
+		"Self Harm Instructions": m.CategoryAppliedInputTypes.SelfHarmInstructions,
+		"Self Harm Intent":       m.CategoryAppliedInputTypes.SelfHarmIntent,
+		"Sexual":                 m.CategoryAppliedInputTypes.Sexual,
+		"Sexual Minors":          m.CategoryAppliedInputTypes.SexualMinors,
+		"Violence":               m.CategoryAppliedInputTypes.Violence,
+		"Violence Graphic":       m.CategoryAppliedInputTypes.ViolenceGraphic,
+		"Illicit":                m.CategoryAppliedInputTypes.Illicit,
+		"Illicit Violent":        m.CategoryAppliedInputTypes.IllicitViolent,
+	}
+
+	types := make(map[string][]string)
+	for _, c := range FlaggedCategories(m) {
+		types[c] = all[c]
+	}
+
+	return types
+}
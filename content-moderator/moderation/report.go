@@ -0,0 +1,259 @@
+package moderation
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// PreviewLength is the number of characters of an input shown in the verdict table.
+	PreviewLength = 50
+	// SpanPreviewLength is the number of characters of a flagged chunk shown with its location.
+	SpanPreviewLength = 200
+)
+
+type Summary struct {
+	Total   int
+	Flagged int
+	// Categories counts the flagged inputs per category.
+	Categories map[string]int
+}
+
+func Summarize(results []Result) Summary {
+	summary := Summary{
+		Total:      len(results),
+		Categories: make(map[string]int),
+	}
+
+	for _, r := range results {
+		if !r.Flagged {
+			continue
+		}
+
+		summary.Flagged++
+		for _, c := range r.AllCategories() {
+			summary.Categories[c]++
+		}
+	}
+
+	return summary
+}
+
+// WriteTable writes one verdict per result followed by the overall summary.
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ITEM\tVERDICT\tCATEGORIES\tCONTENT")
+	for _, r := range results {
+		verdict := "safe"
+		if r.Flagged {
+			verdict = "unsafe"
+		}
+
+		cats := "-"
+		if categories := r.AllCategories(); len(categories) > 0 {
+			cats = strings.Join(categories, ", ")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, verdict, cats, preview(r.Input, PreviewLength))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := Summarize(results)
+
+	_, err := fmt.Fprintf(w, "\n%d of %d items flagged as unsafe\n", summary.Flagged, summary.Total)
+	if err != nil {
+		return err
+	}
+
+	cats := make([]string, 0, len(summary.Categories))
+	for c := range summary.Categories {
+		cats = append(cats, c)
+	}
+
+	sort.Slice(cats, func(i, j int) bool {
+		if summary.Categories[cats[i]] != summary.Categories[cats[j]] {
+			return summary.Categories[cats[i]] > summary.Categories[cats[j]]
+		}
+
+		return cats[i] < cats[j]
+	})
+
+	for _, c := range cats {
+		if _, err := fmt.Fprintf(w, "  %s: %d\n", c, summary.Categories[c]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func preview(input string, length int) string {
+	input = strings.Join(strings.Fields(input), " ")
+
+	runes := []rune(input)
+	if len(runes) <= length {
+		return input
+	}
+
+	return string(runes[:length-3]) + "..."
+}
+
+// WriteSpans writes the location, category scores and content of every flagged chunk, then
+// the findings of images, and for pages with images the categories flagged in the page's text,
+// its images or both, followed by counts.
+func WriteSpans(w io.Writer, results []Result) error {
+	var texts, images []Result
+	for _, r := range results {
+		if r.Image {
+			images = append(images, r)
+		} else {
+			texts = append(texts, r)
+		}
+	}
+
+	flaggedTexts := 0
+	for _, r := range texts {
+		if !r.Flagged {
+			continue
+		}
+		flaggedTexts++
+
+		spans := r.Sentences
+		if len(spans) == 0 {
+			spans = []Result{r}
+		} else if len(r.Matches) > 0 {
+			// Local rule matches are listed with the chunk, they have their own offsets.
+			if err := writeSpan(w, Result{Name: r.Name, Location: r.Location, Matches: r.Matches, Input: r.Input}); err != nil {
+				return err
+			}
+		}
+
+		for _, span := range spans {
+			if err := writeSpan(w, span); err != nil {
+				return err
+			}
+		}
+	}
+
+	flaggedImages := 0
+	for _, r := range images {
+		if !r.Flagged {
+			continue
+		}
+		flaggedImages++
+
+		if _, err := fmt.Fprintf(w, "image %s\n  %s\n\n", r.Name, scores(r)); err != nil {
+			return err
+		}
+	}
+
+	for _, page := range imagePages(images) {
+		types := pageInputTypes(page, texts, images)
+		if len(types) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "page %s\n  %s\n\n", page, strings.Join(types, ", ")); err != nil {
+			return err
+		}
+	}
+
+	counts := make([]string, 0, 2)
+	if len(texts) > 0 {
+		counts = append(counts, fmt.Sprintf("%d of %d chunks", flaggedTexts, len(texts)))
+	}
+	if len(images) > 0 {
+		counts = append(counts, fmt.Sprintf("%d of %d images", flaggedImages, len(images)))
+	}
+
+	_, err := fmt.Fprintf(w, "%s flagged as unsafe\n", strings.Join(counts, " and "))
+	return err
+}
+
+func writeSpan(w io.Writer, r Result) error {
+	where := r.Label()
+	if r.Location != nil {
+		where = fmt.Sprintf("%s (chars %d-%d)", where, r.Location.Start, r.Location.End)
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n  %s\n  %s\n\n", where, scores(r), preview(r.Input, SpanPreviewLength))
+	return err
+}
+
+func scores(r Result) string {
+	scores := make([]string, 0, len(r.Categories))
+	for _, c := range r.Categories {
+		scores = append(scores, fmt.Sprintf("%s %.2f", c, r.Scores[c]))
+	}
+
+	matches := r.matchCounts()
+	for _, c := range matchLabels(r) {
+		scores = append(scores, fmt.Sprintf("%s (%s)", c, describeMatches(matches[c])))
+	}
+
+	return strings.Join(scores, ", ")
+}
+
+// imagePages returns the pages the images were found on, in order.
+func imagePages(images []Result) []string {
+	pages := make([]string, 0)
+	for _, r := range images {
+		if r.Page != "" && !slices.Contains(pages, r.Page) {
+			pages = append(pages, r.Page)
+		}
+	}
+
+	return pages
+}
+
+// pageInputTypes lists the categories flagged on a page with the input types they were
+// flagged in, e.g. "Violence (text, image)". Each image is moderated on its own, so the
+// types of the page are gathered from the results of its text and of its images.
+func pageInputTypes(page string, texts, images []Result) []string {
+	types := make(map[string][]string)
+	add := func(r Result, inputType string) {
+		for _, c := range r.Categories {
+			if !slices.Contains(types[c], inputType) {
+				types[c] = append(types[c], inputType)
+			}
+		}
+	}
+
+	for _, r := range texts {
+		if r.Flagged && r.Name == page {
+			add(r, "text")
+		}
+	}
+
+	flaggedImage := false
+	for _, r := range images {
+		if r.Flagged && r.Page == page {
+			add(r, "image")
+			flaggedImage = true
+		}
+	}
+
+	if !flaggedImage {
+		return nil
+	}
+
+	categories := make([]string, 0, len(types))
+	for c := range types {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	for i, c := range categories {
+		categories[i] = fmt.Sprintf("%s (%s)", c, strings.Join(types[c], ", "))
+	}
+
+	return categories
+}
@@ -0,0 +1,318 @@
+// Package moderator collects content from the supported sources and moderates it,
+// for both the command line and the HTTP service.
+package moderator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"content-moderator/fileops"
+	"content-moderator/moderation"
+	"content-moderator/policy"
+	"content-moderator/rules"
+	"content-moderator/scraper"
+
+	"github.com/openai/openai-go"
+	"github.com/pkg/errors"
+)
+
+// Input is the text and images taken from one source.
+type Input struct {
+	Items  []moderation.Item
+	Images []moderation.Item
+	// BestEffortImages skips images that can't be moderated, e.g. broken links on a page,
+	// instead of failing.
+	BestEffortImages bool
+	// Documents holds the full texts the items were taken from, for redaction.
+	Documents []moderation.Item
+	// Page is the URL of the page the images were found on, their results point back to it.
+	Page string
+}
+
+func FromText(content string) Input {
+	item := moderation.Item{Name: "content", Content: content}
+
+	return Input{
+		Items:     []moderation.Item{item},
+		Documents: []moderation.Item{item},
+	}
+}
+
+// FromLines turns every non-empty line into its own item. Literal "\n" sequences count as line
+// breaks too, since shells pass them through unchanged in quoted flags.
+func FromLines(content string) Input {
+	content = strings.ReplaceAll(content, `\n`, "\n")
+
+	items := make([]moderation.Item, 0)
+	for i, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		items = append(items, moderation.Item{
+			Name:    fmt.Sprintf("line %d", i+1),
+			Content: line,
+		})
+	}
+
+	return Input{Items: items}
+}
+
+// FromDocument splits a long text into chunks named after the document.
+func FromDocument(name, content string) Input {
+	return Input{
+		Items:     moderation.Split(name, content, moderation.MaxChunkLength),
+		Documents: []moderation.Item{{Name: name, Content: content}},
+	}
+}
+
+// FromURL scrapes the page at url, and moderates up to maxImages of its images next to its text.
+// A non-nil transport fetches the page, see scraper.ScrapePage.
+func FromURL(url string, maxImages int, transport http.RoundTripper) (Input, error) {
+	page, err := scraper.ScrapePage(url, transport)
+	if err != nil {
+		return Input{}, errors.Wrap(err, "failed to scrape URL")
+	}
+
+	in := FromDocument(url, page.Text)
+	in.BestEffortImages = true
+	in.Page = url
+
+	if len(page.Images) > maxImages {
+		log.Printf("Moderating %d of the %d images on %s\n", max(maxImages, 0), len(page.Images), url)
+		page.Images = page.Images[:max(maxImages, 0)]
+	}
+
+	for _, src := range page.Images {
+		in.Images = append(in.Images, moderation.Item{Name: src, Content: src})
+	}
+
+	return in, nil
+}
+
+func FromFile(fileLoc string) (Input, error) {
+	content, err := fileops.ReadFile(fileLoc)
+	if err != nil {
+		return Input{}, errors.Wrap(err, "failed to read file")
+	}
+
+	return FromDocument(fileLoc, content), nil
+}
+
+// FromFiles reads every file matching pattern, a directory or glob, as its own document.
+func FromFiles(pattern string) (Input, error) {
+	files, err := fileops.ReadFiles(pattern)
+	if err != nil {
+		return Input{}, errors.Wrap(err, "failed to read files")
+	}
+
+	var in Input
+	for _, f := range files {
+		in.Items = append(in.Items, moderation.Split(f.Path, f.Content, moderation.MaxChunkLength)...)
+		in.Documents = append(in.Documents, moderation.Item{Name: f.Path, Content: f.Content})
+	}
+
+	return in, nil
+}
+
+func FromImageFile(fileLoc string) (Input, error) {
+	dataURL, err := fileops.ReadImage(fileLoc)
+	if err != nil {
+		return Input{}, errors.Wrap(err, "failed to read image")
+	}
+
+	return FromImage(fileLoc, dataURL), nil
+}
+
+// FromImage moderates one image, given by URL or as a base64 data URL.
+func FromImage(name, imageURL string) Input {
+	return Input{Images: []moderation.Item{{Name: name, Content: imageURL}}}
+}
+
+func (in Input) Empty() bool {
+	return len(in.Items) == 0 && len(in.Images) == 0
+}
+
+// Hash identifies the moderated content without storing it, e.g. in the audit log.
+func (in Input) Hash() string {
+	h := sha256.New()
+	for _, items := range [][]moderation.Item{in.Items, in.Images} {
+		for _, item := range items {
+			h.Write([]byte(item.Content))
+			h.Write([]byte{0})
+		}
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Checker moderates inputs with the local rules first and the moderation API after them.
+type Checker struct {
+	Client openai.Client
+	// Rules are checked before the moderation API, nil skips them.
+	Rules *rules.Rules
+	// Offline only checks Rules and skips images, e.g. when no API key is set.
+	Offline bool
+	// Policy decides which chunks and sentences count as flagged, nil follows the API's flags.
+	Policy *policy.Profile
+}
+
+// Run moderates the text of in in batches and each of its images, text results first.
+// Text that a rule blocks or finds safe as a whole is not sent to the moderation API,
+// the matches of the rules are added to the API's results for the rest.
+func (c Checker) Run(ctx context.Context, in Input) ([]moderation.Result, error) {
+	if in.Empty() {
+		return nil, errors.New("no content to moderate")
+	}
+
+	if c.Offline && c.Rules == nil {
+		return nil, errors.New("no rules to moderate with offline")
+	}
+
+	results := make([]moderation.Result, len(in.Items))
+	matches := make([][]moderation.Match, len(in.Items))
+	remote := make([]moderation.Item, 0, len(in.Items))
+	remoteIndex := make([]int, 0, len(in.Items))
+
+	for i, item := range in.Items {
+		var safe bool
+		if c.Rules != nil {
+			matches[i], safe = c.Rules.Check(item.Content)
+		}
+
+		if c.Offline || (safe && len(matches[i]) == 0) || blocked(matches[i]) {
+			results[i] = moderation.Result{
+				Name:       item.Name,
+				Input:      item.Content,
+				Location:   item.Location,
+				Categories: []string{},
+				Scores:     map[string]float64{},
+				Local:      true,
+			}
+			continue
+		}
+
+		remote = append(remote, item)
+		remoteIndex = append(remoteIndex, i)
+	}
+
+	if len(remote) > 0 {
+		remoteResults, err := moderation.Moderate(ctx, c.Client, remote)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, r := range remoteResults {
+			results[remoteIndex[j]] = r
+		}
+
+		if err := c.narrow(ctx, remote, remoteResults, results, remoteIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range results {
+		results[i].AddMatches(matches[i])
+	}
+
+	for _, img := range in.Images {
+		if c.Offline {
+			if in.BestEffortImages {
+				log.Println("Skipping image, images can't be moderated offline:", img.Name)
+				continue
+			}
+
+			return nil, errors.Errorf("image %s can't be moderated offline", img.Name)
+		}
+
+		result, err := moderation.ModerateImage(ctx, c.Client, img.Name, img.Content)
+		if err != nil {
+			if in.BestEffortImages {
+				log.Println("Skipping image:", err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		result.Page = in.Page
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return nil, errors.New("no content could be moderated")
+	}
+
+	return results, nil
+}
+
+// narrow moderates the sentences of every flagged chunk on their own, and keeps the flagged
+// ones with the chunk's result, so that reports can point at them instead of the whole chunk.
+func (c Checker) narrow(
+	ctx context.Context,
+	items []moderation.Item,
+	itemResults []moderation.Result,
+	results []moderation.Result,
+	index []int,
+) error {
+	sentences := make([]moderation.Item, 0)
+	owners := make([]int, 0)
+	for j, r := range itemResults {
+		if !c.Flagged(r) {
+			continue
+		}
+
+		parts := moderation.Sentences(items[j])
+		if len(parts) < 2 {
+			continue
+		}
+
+		for _, p := range parts {
+			sentences = append(sentences, p)
+			owners = append(owners, index[j])
+		}
+	}
+
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	sentenceResults, err := moderation.Moderate(ctx, c.Client, sentences)
+	if err != nil {
+		return err
+	}
+
+	for k, r := range sentenceResults {
+		if c.Flagged(r) {
+			results[owners[k]].Sentences = append(results[owners[k]].Sentences, r)
+		}
+	}
+
+	return nil
+}
+
+// Flagged reports whether the moderation API's scores of r count against it: by the decision
+// of the policy when there is one, otherwise by the API's flags. Local rule matches don't count.
+func (c Checker) Flagged(r moderation.Result) bool {
+	r.Matches = nil
+	if c.Policy != nil {
+		return c.Policy.Decide(r).Action != policy.Allow
+	}
+
+	return len(r.Categories) > 0
+}
+
+func blocked(matches []moderation.Match) bool {
+	for _, m := range matches {
+		if policy.Action(m.Action) == policy.Block {
+			return true
+		}
+	}
+
+	return false
+}
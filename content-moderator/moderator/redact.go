@@ -0,0 +1,199 @@
+package moderator
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"content-moderator/moderation"
+	"content-moderator/policy"
+
+	"github.com/pkg/errors"
+)
+
+// ModerationSource marks redactions of text flagged by the moderation API, the other
+// redactions are named after the kind of local rule that matched.
+const ModerationSource = "moderation"
+
+// Redaction is one span of a document replaced by a token. Original keeps the replaced text,
+// so the mapping must be stored as carefully as the input.
+type Redaction struct {
+	Token    string `json:"token"`
+	Category string `json:"category"`
+	Source   string `json:"source"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Original string `json:"original"`
+}
+
+type Redacted struct {
+	Name       string      `json:"name"`
+	Text       string      `json:"-"`
+	Redactions []Redaction `json:"redactions"`
+}
+
+// Redact replaces the flagged sentences and the matches of the local rules in every document of
+// in with category tokens such as [HARASSMENT] or [EMAIL]. With a profile, sentences are replaced
+// when it doesn't allow them, else when the API flags them. A flagged chunk none of whose
+// sentences is flagged on its own is replaced as a whole. Matches of allow rules are kept.
+func Redact(
+	in Input,
+	results []moderation.Result,
+	profile *policy.Profile,
+) ([]Redacted, error) {
+	if len(in.Documents) == 0 {
+		return nil, errors.New("only texts, files and pages can be redacted")
+	}
+
+	redacted := make([]Redacted, 0, len(in.Documents))
+	for _, doc := range in.Documents {
+		runes := []rune(doc.Content)
+
+		spans := make([]Redaction, 0)
+		for _, r := range results {
+			if r.Image || r.Name != doc.Name {
+				continue
+			}
+
+			start, end := 0, len(runes)
+			if r.Location != nil {
+				start, end = r.Location.Start, r.Location.End
+			}
+
+			if flaggedCategory(r, profile) != "" {
+				flagged := r.Sentences
+				if len(flagged) == 0 {
+					flagged = []moderation.Result{r}
+				}
+
+				for _, f := range flagged {
+					span := Redaction{Category: flaggedCategory(f, profile), Source: ModerationSource, Start: start, End: end}
+					if f.Location != nil {
+						span.Start, span.End = f.Location.Start, f.Location.End
+					}
+
+					spans = append(spans, span)
+				}
+			}
+
+			for _, m := range r.Matches {
+				if policy.Action(m.Action) == policy.Allow {
+					continue
+				}
+
+				spans = append(spans, Redaction{Category: m.Label(), Source: m.Rule, Start: start + m.Start, End: start + m.End})
+			}
+		}
+
+		text, redactions := replace(runes, spans)
+		redacted = append(redacted, Redacted{
+			Name:       doc.Name,
+			Text:       text,
+			Redactions: redactions,
+		})
+	}
+
+	return redacted, nil
+}
+
+// flaggedCategory returns the moderation category a chunk or sentence is redacted for, the one
+// with the highest score, or "" when it is kept.
+func flaggedCategory(r moderation.Result, profile *policy.Profile) string {
+	candidates := make([]string, 0)
+	if profile == nil {
+		candidates = append(candidates, r.Categories...)
+	} else {
+		apiOnly := r
+		apiOnly.Matches = nil
+		if profile.Decide(apiOnly).Action == policy.Allow {
+			return ""
+		}
+
+		for category, name := range moderation.Categories {
+			if !slices.Contains(profile.Allow, category) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	sort.Strings(candidates)
+
+	top := ""
+	for _, c := range candidates {
+		if top == "" || r.Scores[c] > r.Scores[top] {
+			top = c
+		}
+	}
+
+	return top
+}
+
+// replace substitutes the spans in runes with their tokens. Overlapping spans are replaced
+// as one, under the category of the span that starts first.
+func replace(runes []rune, spans []Redaction) (string, []Redaction) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+
+		return spans[i].End > spans[j].End
+	})
+
+	merged := make([]Redaction, 0, len(spans))
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.Start < merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, s.End)
+			continue
+		}
+
+		merged = append(merged, s)
+	}
+
+	var b strings.Builder
+	last := 0
+	for i := range merged {
+		s := &merged[i]
+		s.Token = Token(s.Category)
+		s.Line, s.Column = moderation.Position(runes, s.Start)
+		s.Original = string(runes[s.Start:s.End])
+
+		b.WriteString(string(runes[last:s.Start]))
+		b.WriteString(s.Token)
+		last = s.End
+	}
+	b.WriteString(string(runes[last:]))
+
+	return b.String(), merged
+}
+
+// Token is the placeholder of a category in redacted text, e.g. [SELF_HARM_INTENT].
+func Token(category string) string {
+	return "[" + strings.ToUpper(strings.Join(strings.Fields(category), "_")) + "]"
+}
+
+// WriteRedactions lists where each token was put, without the replaced text.
+func WriteRedactions(w io.Writer, redacted []Redacted) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "LOCATION\tTOKEN\tSOURCE\tCHARS")
+
+	total := 0
+	for _, d := range redacted {
+		for _, r := range d.Redactions {
+			total++
+			fmt.Fprintf(tw, "%s:%d:%d\t%s\t%s\t%d-%d\n", d.Name, r.Line, r.Column, r.Token, r.Source, r.Start, r.End)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d spans redacted\n", total)
+	return err
+}
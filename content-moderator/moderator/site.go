@@ -0,0 +1,137 @@
+package moderator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"content-moderator/moderation"
+	"content-moderator/policy"
+	"content-moderator/scraper"
+
+	"github.com/pkg/errors"
+)
+
+// PageReport sums up the moderation of one crawled page.
+type PageReport struct {
+	URL           string
+	Depth         int
+	Chunks        int
+	FlaggedChunks int
+	Categories    []string
+	// TopCategory is the category with the highest score on the page, TopScore its score.
+	TopCategory string
+	TopScore    float64
+	// Action is the decision of the policy profile, empty without one.
+	Action policy.Action
+}
+
+// FromCrawl crawls the site from startURL and moderates the text of every page found.
+func FromCrawl(startURL string, opts scraper.CrawlOptions) (Input, []scraper.Page, error) {
+	pages, err := scraper.Crawl(startURL, opts)
+	if err != nil {
+		return Input{}, nil, errors.Wrap(err, "failed to crawl site")
+	}
+
+	var in Input
+	for _, p := range pages {
+		in.Items = append(in.Items, moderation.Split(p.URL, p.Text, moderation.MaxChunkLength)...)
+		in.Documents = append(in.Documents, moderation.Item{Name: p.URL, Content: p.Text})
+	}
+
+	return in, pages, nil
+}
+
+// SiteReport reports every page, most severe first: by the decision of profile when set,
+// then flagged pages, then by their highest category score.
+func SiteReport(
+	pages []scraper.Page,
+	results []moderation.Result,
+	profile *policy.Profile,
+) []PageReport {
+	byPage := make(map[string][]moderation.Result)
+	for _, r := range results {
+		byPage[r.Name] = append(byPage[r.Name], r)
+	}
+
+	reports := make([]PageReport, 0, len(pages))
+	for _, p := range pages {
+		report := PageReport{
+			URL:    p.URL,
+			Depth:  p.Depth,
+			Chunks: len(byPage[p.URL]),
+		}
+
+		for _, r := range byPage[p.URL] {
+			if r.Flagged {
+				report.FlaggedChunks++
+			}
+		}
+
+		if merged := moderation.Merge(byPage[p.URL]); len(merged) > 0 {
+			report.Categories = merged[0].AllCategories()
+			for c, score := range merged[0].Scores {
+				if score > report.TopScore || (score == report.TopScore && c < report.TopCategory) {
+					report.TopCategory, report.TopScore = c, score
+				}
+			}
+		}
+
+		if profile != nil && len(byPage[p.URL]) > 0 {
+			report.Action = profile.DecideAll(byPage[p.URL]).Action
+		}
+
+		reports = append(reports, report)
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Action.Severity() != b.Action.Severity() {
+			return a.Action.Severity() > b.Action.Severity()
+		}
+
+		if (a.FlaggedChunks > 0) != (b.FlaggedChunks > 0) {
+			return a.FlaggedChunks > 0
+		}
+
+		return a.TopScore > b.TopScore
+	})
+
+	return reports
+}
+
+func WriteSiteReport(w io.Writer, reports []PageReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RANK\tACTION\tFLAGGED\tTOP SCORE\tCATEGORIES\tDEPTH\tURL")
+
+	flagged := 0
+	for i, r := range reports {
+		action := "-"
+		if r.Action != "" {
+			action = string(r.Action)
+		}
+
+		cats := "-"
+		if len(r.Categories) > 0 {
+			cats = strings.Join(r.Categories, ", ")
+			flagged++
+		}
+
+		top := "-"
+		if r.TopCategory != "" {
+			top = fmt.Sprintf("%s %.2f", r.TopCategory, r.TopScore)
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%s\t%s\t%d\t%s\n", i+1, action, r.FlaggedChunks, r.Chunks, top, cats, r.Depth, r.URL)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d of %d pages flagged as unsafe\n", flagged, len(reports))
+	return err
+}
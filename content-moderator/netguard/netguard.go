@@ -0,0 +1,99 @@
+// Package netguard keeps requests made on behalf of HTTP callers away from the moderator's own
+// network: loopback, private, link-local and unspecified addresses, e.g. cloud metadata at
+// 169.254.169.254, are refused.
+package netguard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DialTimeout = 10 * time.Second
+
+// reserved are ranges not covered by the netip checks that are still not reachable publicly.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// Public reports whether ip may be connected to.
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	for _, prefix := range reserved {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// control runs after the host is resolved and before connecting, so it checks the address
+// actually dialled, also after redirects and DNS changes.
+func control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid address %s", address)
+	}
+
+	if !Public(addrPort.Addr()) {
+		return errors.Errorf("address %s is not public", addrPort.Addr())
+	}
+
+	return nil
+}
+
+// Transport is an HTTP transport that only connects to public addresses. Proxies from the
+// environment are not used, since they would be dialled instead of the target.
+func Transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: DialTimeout,
+		Control: control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+// CheckURL rejects URLs that aren't http or https, or whose host resolves to an address
+// that isn't public. It is meant for URLs fetched by others, e.g. images the moderation
+// API downloads, and for early errors; Transport still checks every connection.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("must be an http or https URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %s", u.Hostname())
+	}
+
+	for _, addr := range addrs {
+		if !Public(addr) {
+			return errors.Errorf("%s resolves to %s, which is not a public address", u.Hostname(), addr.Unmap())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"content-moderator/moderation"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type Action string
+
+const (
+	Allow  Action = "allow"
+	Review Action = "review"
+	Block  Action = "block"
+)
+
+//go:embed profiles/*.yaml
+var builtin embed.FS
+
+// Threshold holds the category scores from which content is sent to review or blocked.
+// A zero threshold is not applied.
+type Threshold struct {
+	Review float64 `yaml:"review,omitempty"`
+	Block  float64 `yaml:"block,omitempty"`
+}
+
+type Profile struct {
+	Name string `yaml:"name"`
+	// Version is recorded with every decision. When the YAML has none, a hash of it is used,
+	// so that any edit of a profile changes its version.
+	Version     string `yaml:"version,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	// Thresholds is keyed by the API's category names, e.g. "violence/graphic".
+	Thresholds map[string]Threshold `yaml:"thresholds,omitempty"`
+	// Allow lists categories that never count against content, even when the API flags them.
+	Allow []string `yaml:"allow,omitempty"`
+	// Flagged is the action for categories the API flags and the profile has no threshold for.
+	Flagged Action `yaml:"flagged,omitempty"`
+}
+
+type Decision struct {
+	Action  Action   `json:"action"`
+	Reasons []string `json:"reasons"`
+}
+
+// Default follows the moderation API's own flags: anything flagged is blocked.
+func Default() *Profile {
+	return &Profile{
+		Name:    "default",
+		Version: "api-flags",
+		Flagged: Block,
+	}
+}
+
+// Builtin returns the names of the profiles shipped with the moderator.
+func Builtin() []string {
+	entries, _ := builtin.ReadDir("profiles")
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+	}
+
+	return names
+}
+
+// Load reads a profile from a YAML file when nameOrPath has a .yaml or .yml extension,
+// and returns the built-in profile of that name otherwise.
+func Load(nameOrPath string) (*Profile, error) {
+	ext := filepath.Ext(nameOrPath)
+	if ext == ".yaml" || ext == ".yml" {
+		data, err := os.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read policy profile")
+		}
+
+		p, err := Parse(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid policy profile %s", nameOrPath)
+		}
+
+		return p, nil
+	}
+
+	data, err := builtin.ReadFile("profiles/" + nameOrPath + ".yaml")
+	if err != nil {
+		return nil, errors.Errorf("unknown policy profile %q, built-in profiles: %s", nameOrPath, strings.Join(Builtin(), ", "))
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Profile, error) {
+	var p Profile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse policy profile")
+	}
+
+	if p.Name == "" {
+		return nil, errors.New("policy profile has no name")
+	}
+
+	if p.Version == "" {
+		sum := sha256.Sum256(data)
+		p.Version = "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	if p.Flagged == "" {
+		p.Flagged = Block
+	}
+
+	if !validAction(p.Flagged) {
+		return nil, errors.Errorf("unknown action %q, allowed values: allow, review, block", p.Flagged)
+	}
+
+	for category, t := range p.Thresholds {
+		if _, ok := moderation.Categories[category]; !ok {
+			return nil, errors.Errorf("unknown category %q in thresholds", category)
+		}
+
+		if t.Review < 0 || t.Review > 1 || t.Block < 0 || t.Block > 1 {
+			return nil, errors.Errorf("thresholds of %q must be between 0 and 1", category)
+		}
+
+		if t.Review > 0 && t.Block > 0 && t.Review > t.Block {
+			return nil, errors.Errorf("review threshold of %q is above its block threshold", category)
+		}
+	}
+
+	for _, category := range p.Allow {
+		if _, ok := moderation.Categories[category]; !ok {
+			return nil, errors.Errorf("unknown category %q in allow", category)
+		}
+	}
+
+	return &p, nil
+}
+
+func validAction(a Action) bool {
+	return a == Allow || a == Review || a == Block
+}
+
+// Decide applies the profile to one moderation result.
+func (p *Profile) Decide(r moderation.Result) Decision {
+	decision := Decision{Action: Allow, Reasons: []string{}}
+
+	categories := make([]string, 0, len(moderation.Categories))
+	for category := range moderation.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		if slices.Contains(p.Allow, category) {
+			continue
+		}
+
+		name := moderation.Categories[category]
+		score := r.Scores[name]
+
+		if t, ok := p.Thresholds[category]; ok {
+			switch {
+			case t.Block > 0 && score >= t.Block:
+				decision.add(Block, fmt.Sprintf("%s score %.2f reaches the block threshold %.2f", name, score, t.Block))
+			case t.Review > 0 && score >= t.Review:
+				decision.add(Review, fmt.Sprintf("%s score %.2f reaches the review threshold %.2f", name, score, t.Review))
+			}
+
+			continue
+		}
+
+		if slices.Contains(r.Categories, name) && p.Flagged != Allow {
+			decision.add(p.Flagged, fmt.Sprintf("%s flagged by the moderation API (score %.2f)", name, score))
+		}
+	}
+
+	// Local rules carry their own action, reported once per category and action.
+	seen := make(map[string]bool)
+	for _, m := range r.Matches {
+		key := m.Category + "\x00" + m.Action
+		if seen[key] || Action(m.Action) == Allow {
+			continue
+		}
+		seen[key] = true
+
+		decision.add(Action(m.Action), fmt.Sprintf("%s matched by a local %s rule", m.Label(), m.Rule))
+	}
+
+	return decision
+}
+
+func (d *Decision) add(action Action, reason string) {
+	if action.Severity() > d.Action.Severity() {
+		d.Action = action
+	}
+
+	d.Reasons = append(d.Reasons, reason)
+}
+
+// DecideAll applies the profile to the results of all items and chunks of some content.
+func (p *Profile) DecideAll(results []moderation.Result) Decision {
+	names := make([]string, len(results))
+	decisions := make([]Decision, len(results))
+	for i, r := range results {
+		names[i] = r.Label()
+		decisions[i] = p.Decide(r)
+	}
+
+	if len(results) == 1 {
+		return decisions[0]
+	}
+
+	return Combine(names, decisions)
+}
+
+// Combine returns the most severe of the decisions, with the reasons of all of them prefixed
+// by the name of the item they were made for.
+func Combine(names []string, decisions []Decision) Decision {
+	combined := Decision{Action: Allow, Reasons: []string{}}
+
+	for i, d := range decisions {
+		if d.Action.Severity() > combined.Action.Severity() {
+			combined.Action = d.Action
+		}
+
+		for _, reason := range d.Reasons {
+			combined.Reasons = append(combined.Reasons, fmt.Sprintf("%s: %s", names[i], reason))
+		}
+	}
+
+	return combined
+}
+
+// Severity orders actions from allow, the least severe, to block.
+func (a Action) Severity() int {
+	switch a {
+	case Block:
+		return 2
+	case Review:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,146 @@
+package rules
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"content-moderator/moderation"
+)
+
+const (
+	Email = "email"
+	Phone = "phone"
+	Card  = "card"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\d{2,6}(?:[\s.-]?\d{2,6}){1,4}`)
+	cardPattern  = regexp.MustCompile(`\d(?:[ -]?\d){12,18}`)
+)
+
+// detectPII finds personal data in text. Card numbers must pass the Luhn check, and phone
+// numbers need 10 to 15 digits, or 8 with a country code, and the shape of a phone number,
+// so that dates, years, order numbers and other runs of digits are not taken for them.
+func detectPII(text string, detectors []string, action string) []moderation.Match {
+	enabled := make(map[string]bool)
+	for _, d := range detectors {
+		enabled[d] = true
+	}
+
+	matches := make([]moderation.Match, 0)
+
+	var cards [][]int
+	if enabled[Card] {
+		for _, loc := range cardPattern.FindAllStringIndex(text, -1) {
+			if !standalone(text, loc) {
+				continue
+			}
+
+			digits := digitsOf(text[loc[0]:loc[1]])
+			if len(digits) >= 13 && len(digits) <= 19 && luhn(digits) {
+				cards = append(cards, loc)
+				matches = append(matches, match(text, loc, Card, "pii", action))
+			}
+		}
+	}
+
+	if enabled[Phone] {
+		for _, loc := range phonePattern.FindAllStringIndex(text, -1) {
+			if !standalone(text, loc) || overlaps(cards, loc) {
+				continue
+			}
+
+			n := len(digitsOf(text[loc[0]:loc[1]]))
+			international := text[loc[0]] == '+'
+			if n > 15 || n < 8 || (n < 10 && !international) || !phoneShaped(text[loc[0]:loc[1]]) {
+				continue
+			}
+
+			matches = append(matches, match(text, loc, Phone, "pii", action))
+		}
+	}
+
+	if enabled[Email] {
+		for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+			matches = append(matches, match(text, loc, Email, "pii", action))
+		}
+	}
+
+	return matches
+}
+
+// phoneShaped accepts numbers with a country code or an area code in parentheses, and
+// numbers written in at least three groups of 2 to 4 digits, e.g. 555-123-4567.
+func phoneShaped(s string) bool {
+	if s[0] == '+' || s[0] == '(' {
+		return true
+	}
+
+	groups := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '.' || r == '-'
+	})
+	if len(groups) < 3 {
+		return false
+	}
+
+	for _, g := range groups {
+		if len(g) < 2 || len(g) > 4 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// luhn validates the check digit of a card number.
+func luhn(digits []int) bool {
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+func digitsOf(s string) []int {
+	digits := make([]int, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+
+	return digits
+}
+
+// standalone rejects numbers that are part of a longer word or number, e.g. in IDs.
+func standalone(text string, loc []int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+	after, _ := utf8.DecodeRuneInString(text[loc[1]:])
+
+	return !wordRune(before) && !wordRune(after)
+}
+
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func overlaps(spans [][]int, loc []int) bool {
+	for _, s := range spans {
+		if loc[0] < s[1] && s[0] < loc[1] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,311 @@
+// Package rules is the local first pass of the moderator: word lists, regular expressions,
+// personal data detectors and blocked domains, checked without calling the moderation API.
+package rules
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"content-moderator/moderation"
+	"content-moderator/policy"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// BlockedDomain is the category of links to blocked domains, unless the rules name another.
+const BlockedDomain = "blocked-domain"
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+var domainPattern = regexp.MustCompile(`(?i)\b(?:https?://)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}(?::\d+)?(?:[/?#][^\s<>"')\]]*)?`)
+
+type Rules struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	// Safe holds patterns of text that is safe as a whole, e.g. short acknowledgements.
+	// Such text skips the moderation API when no other rule matches it.
+	Safe     []string   `yaml:"safe,omitempty"`
+	PII      PII        `yaml:"pii,omitempty"`
+	Words    []WordList `yaml:"words,omitempty"`
+	Patterns []Pattern  `yaml:"patterns,omitempty"`
+	Domains  DomainList `yaml:"domains,omitempty"`
+
+	safe     []*regexp.Regexp
+	words    []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+type PII struct {
+	// Detectors lists the personal data looked for: email, phone and card.
+	Detectors []string      `yaml:"detectors,omitempty"`
+	Action    policy.Action `yaml:"action,omitempty"`
+}
+
+// WordList holds words and phrases, matched case-insensitively as whole words.
+type WordList struct {
+	Category string        `yaml:"category"`
+	Action   policy.Action `yaml:"action,omitempty"`
+	Words    []string      `yaml:"words"`
+}
+
+type Pattern struct {
+	Category string        `yaml:"category"`
+	Action   policy.Action `yaml:"action,omitempty"`
+	Regex    string        `yaml:"regex"`
+}
+
+// DomainList matches links and bare domain names of the blocked domains and their subdomains.
+type DomainList struct {
+	Category string        `yaml:"category,omitempty"`
+	Action   policy.Action `yaml:"action,omitempty"`
+	Blocked  []string      `yaml:"blocked,omitempty"`
+}
+
+// Builtin returns the names of the rule sets shipped with the moderator.
+func Builtin() []string {
+	entries, _ := builtin.ReadDir("builtin")
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+	}
+
+	return names
+}
+
+// Load reads rules from a YAML file when nameOrPath has a .yaml or .yml extension,
+// and returns the built-in rules of that name otherwise.
+func Load(nameOrPath string) (*Rules, error) {
+	ext := filepath.Ext(nameOrPath)
+	if ext == ".yaml" || ext == ".yml" {
+		data, err := os.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read rules")
+		}
+
+		r, err := Parse(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rules %s", nameOrPath)
+		}
+
+		return r, nil
+	}
+
+	data, err := builtin.ReadFile("builtin/" + nameOrPath + ".yaml")
+	if err != nil {
+		return nil, errors.Errorf("unknown rules %q, built-in rules: %s", nameOrPath, strings.Join(Builtin(), ", "))
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Rules, error) {
+	var r Rules
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rules")
+	}
+
+	if r.Name == "" {
+		return nil, errors.New("rules have no name")
+	}
+
+	if r.Version == "" {
+		sum := sha256.Sum256(data)
+		r.Version = "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	for _, expr := range r.Safe {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid safe pattern %q", expr)
+		}
+		r.safe = append(r.safe, re)
+	}
+
+	for _, d := range r.PII.Detectors {
+		if d != Email && d != Phone && d != Card {
+			return nil, errors.Errorf("unknown PII detector %q, allowed values: email, phone, card", d)
+		}
+	}
+	if err := defaultAction(&r.PII.Action); err != nil {
+		return nil, errors.Wrap(err, "invalid pii")
+	}
+
+	for i := range r.Words {
+		list := &r.Words[i]
+		if list.Category == "" {
+			return nil, errors.New("word list has no category")
+		}
+
+		if err := defaultAction(&list.Action); err != nil {
+			return nil, errors.Wrapf(err, "invalid word list %q", list.Category)
+		}
+
+		r.words = append(r.words, wordsPattern(list.Words))
+	}
+
+	for i := range r.Patterns {
+		p := &r.Patterns[i]
+		if p.Category == "" {
+			return nil, errors.Errorf("pattern %q has no category", p.Regex)
+		}
+
+		if err := defaultAction(&p.Action); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", p.Category)
+		}
+
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", p.Category)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	if r.Domains.Category == "" {
+		r.Domains.Category = BlockedDomain
+	}
+	if err := defaultAction(&r.Domains.Action); err != nil {
+		return nil, errors.Wrap(err, "invalid domains")
+	}
+	for i, d := range r.Domains.Blocked {
+		r.Domains.Blocked[i] = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+	}
+
+	return &r, nil
+}
+
+// defaultAction blocks unless the rule says otherwise.
+func defaultAction(a *policy.Action) error {
+	if *a == "" {
+		*a = policy.Block
+	}
+
+	if *a != policy.Allow && *a != policy.Review && *a != policy.Block {
+		return errors.Errorf("unknown action %q, allowed values: allow, review, block", *a)
+	}
+
+	return nil
+}
+
+// wordsPattern matches any of words. Word boundaries are only required next to letters and
+// digits, so that entries such as "c++" match as well.
+func wordsPattern(words []string) *regexp.Regexp {
+	alternatives := make([]string, 0, len(words))
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+
+		alt := regexp.QuoteMeta(w)
+		if first, _ := utf8.DecodeRuneInString(w); wordRune(first) {
+			alt = `\b` + alt
+		}
+		if last, _ := utf8.DecodeLastRuneInString(w); wordRune(last) {
+			alt += `\b`
+		}
+
+		alternatives = append(alternatives, alt)
+	}
+
+	if len(alternatives) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile(`(?i)` + strings.Join(alternatives, "|"))
+}
+
+// Check returns the matches of every rule in text, ordered by position, and whether text is
+// safe as a whole by one of the safe patterns.
+func (r *Rules) Check(text string) ([]moderation.Match, bool) {
+	matches := detectPII(text, r.PII.Detectors, string(r.PII.Action))
+
+	for i, re := range r.words {
+		if re == nil {
+			continue
+		}
+
+		list := r.Words[i]
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, match(text, loc, list.Category, "word", string(list.Action)))
+		}
+	}
+
+	for i, re := range r.patterns {
+		p := r.Patterns[i]
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+
+			matches = append(matches, match(text, loc, p.Category, "pattern", string(p.Action)))
+		}
+	}
+
+	if len(r.Domains.Blocked) > 0 {
+		for _, loc := range domainPattern.FindAllStringIndex(text, -1) {
+			if r.blocked(text[loc[0]:loc[1]]) {
+				matches = append(matches, match(text, loc, r.Domains.Category, "domain", string(r.Domains.Action)))
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+
+	safe := false
+	for _, re := range r.safe {
+		if re.MatchString(text) {
+			safe = true
+			break
+		}
+	}
+
+	return matches, safe
+}
+
+func (r *Rules) blocked(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, d := range r.Domains.Blocked {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match converts the byte offsets of a regular expression match into character offsets,
+// the unit of moderation.Location.
+func match(text string, loc []int, category, rule, action string) moderation.Match {
+	start := utf8.RuneCountInString(text[:loc[0]])
+
+	return moderation.Match{
+		Category: category,
+		Rule:     rule,
+		Action:   action,
+		Start:    start,
+		End:      start + utf8.RuneCountInString(text[loc[0]:loc[1]]),
+	}
+}
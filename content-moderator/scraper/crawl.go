@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"log"
+	neturl "net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/pkg/errors"
+)
+
+type CrawlOptions struct {
+	// AllowedDomains limits the crawl, it defaults to the domain of the start URL.
+	AllowedDomains []string
+	// MaxDepth is the number of links followed from the start page, 0 visits it only.
+	MaxDepth int
+	// MaxPages stops following links once that many pages were visited, 0 doesn't limit them.
+	MaxPages int
+	// Parallelism is the number of pages fetched at the same time per domain.
+	Parallelism int
+	// Delay is waited between requests to the same domain.
+	Delay time.Duration
+	// IgnoreRobotsTxt visits pages disallowed by the site's robots.txt.
+	IgnoreRobotsTxt bool
+}
+
+// Crawl visits startURL and the pages it links to within the allowed domains,
+// and returns every page found ordered by depth and URL.
+func Crawl(startURL string, opts CrawlOptions) ([]Page, error) {
+	u, err := neturl.Parse(startURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Errorf("invalid start URL: %q", startURL)
+	}
+
+	// colly takes a max depth of 0 as unlimited, which -1 would turn into.
+	if opts.MaxDepth < 0 {
+		return nil, errors.Errorf("invalid max depth: %d", opts.MaxDepth)
+	}
+
+	domains := opts.AllowedDomains
+	if len(domains) == 0 {
+		domains = []string{u.Hostname()}
+	}
+
+	c := colly.NewCollector(
+		colly.UserAgent(UserAgent),
+		colly.AllowedDomains(domains...),
+		colly.MaxDepth(opts.MaxDepth+1),
+		colly.Async(true),
+	)
+	c.IgnoreRobotsTxt = opts.IgnoreRobotsTxt
+
+	err = c.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: max(opts.Parallelism, 1),
+		Delay:       opts.Delay,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid crawl limits")
+	}
+
+	var mu sync.Mutex
+	pages := make([]Page, 0)
+	visits := 0
+
+	c.OnRequest(func(r *colly.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if opts.MaxPages > 0 && visits >= opts.MaxPages {
+			r.Abort()
+			return
+		}
+		visits++
+	})
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		page := extract(e)
+
+		mu.Lock()
+		pages = append(pages, page)
+		mu.Unlock()
+
+		e.ForEach("a[href]", func(_ int, a *colly.HTMLElement) {
+			// Errors are expected here, e.g. for links outside the allowed domains or seen before.
+			_ = a.Request.Visit(a.Attr("href"))
+		})
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+	})
+
+	if err := c.Visit(startURL); err != nil {
+		return nil, errors.Wrap(err, "failed to visit start URL")
+	}
+
+	c.Wait()
+
+	if len(pages) == 0 {
+		return nil, errors.Errorf("no pages found from %s", startURL)
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Depth != pages[j].Depth {
+			return pages[i].Depth < pages[j].Depth
+		}
+
+		return pages[i].URL < pages[j].URL
+	})
+
+	return pages, nil
+}
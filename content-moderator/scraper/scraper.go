@@ -1,36 +1,59 @@
 package scraper
 
 import (
-	"bytes"
 	"log"
+	"net/http"
+	neturl "net/url"
+	"path"
 	"strings"
 
+	"readability"
+
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly/v2"
 	"github.com/pkg/errors"
 )
 
+const UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"
+
+type Page struct {
+	URL string
+	// Depth is the number of links followed from the start page of a crawl.
+	Depth int
+	Title string
+	// Text is the readable content of the page, starting with its title, in paragraphs
+	// separated by blank lines.
+	Text string
+	// Images holds the absolute URLs of the page's images, without duplicates.
+	Images []string
+}
+
 func ScrapeURL(url string) (string, error) {
+	page, err := ScrapePage(url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return page.Text, nil
+}
+
+// ScrapePage returns the text of the page at url and the images it shows. The page is fetched
+// with transport when set, e.g. to keep callers of the HTTP service out of the private network.
+func ScrapePage(url string, transport http.RoundTripper) (Page, error) {
 	if url == "" {
-		return "", errors.New("empty URL provided")
+		return Page{}, errors.New("empty URL provided")
 	}
 
 	c := colly.NewCollector(
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"),
+		colly.UserAgent(UserAgent),
 	)
+	if transport != nil {
+		c.WithTransport(transport)
+	}
 
-	var textBuffer bytes.Buffer
-
-	c.OnHTML("script, style, meta, link, noscript", func(e *colly.HTMLElement) {
-		// Do nothing, effectively skipping these elements
-	})
-
-	c.OnHTML("p, h1, h2, h3, h4, h5, h6, span, div, li, td, th, a", func(e *colly.HTMLElement) {
-		// Get the text and clean it
-		text := strings.TrimSpace(e.Text)
-		if text != "" {
-			textBuffer.WriteString(text)
-			textBuffer.WriteString("\n")
-		}
+	var page Page
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		page = extract(e)
 	})
 
 	c.OnError(func(r *colly.Response, err error) {
@@ -39,27 +62,57 @@ func ScrapeURL(url string) (string, error) {
 
 	err := c.Visit(url)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to visit URL")
+		return Page{}, errors.Wrap(err, "failed to visit URL")
 	}
 
 	c.Wait()
 
-	return cleanupText(textBuffer.String()), nil
+	return page, nil
 }
 
-func cleanupText(text string) string {
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	text = strings.Join(strings.Fields(text), " ")
+// extract reads the text and images of a whole HTML document.
+func extract(e *colly.HTMLElement) Page {
+	article := readability.FromSelection(e.DOM)
+
+	paragraphs := article.Paragraphs
+	if article.Title != "" && (len(paragraphs) == 0 || paragraphs[0] != article.Title) {
+		paragraphs = append([]string{article.Title}, paragraphs...)
+	}
 
-	lines := strings.Split(text, "\n")
-	var cleanLines []string
+	var images []string
+	seen := make(map[string]bool)
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed != "" {
-			cleanLines = append(cleanLines, trimmed)
+	e.DOM.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		src := e.Request.AbsoluteURL(s.AttrOr("src", ""))
+		if !supportedImage(src) || seen[src] {
+			return
 		}
+
+		seen[src] = true
+		images = append(images, src)
+	})
+
+	return Page{
+		URL:    e.Request.URL.String(),
+		Depth:  e.Request.Depth - 1,
+		Title:  article.Title,
+		Text:   strings.Join(paragraphs, "\n\n"),
+		Images: images,
 	}
+}
 
-	return strings.Join(cleanLines, "\n")
+// supportedImage skips images the moderation API can't read, such as SVGs and icons
+// inlined as data URLs.
+func supportedImage(src string) bool {
+	u, err := neturl.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".svg", ".ico":
+		return false
+	default:
+		return true
+	}
 }
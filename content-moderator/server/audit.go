@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditEntry records one moderation decision. It holds a hash of the input instead of the
+// input itself, so the log can be kept for compliance review without storing user content.
+type AuditEntry struct {
+	Time          time.Time          `json:"time"`
+	ID            string             `json:"id"`
+	Source        string             `json:"source"`
+	InputHash     string             `json:"input_hash"`
+	Action        string             `json:"action,omitempty"`
+	Reasons       []string           `json:"reasons,omitempty"`
+	Categories    []string           `json:"categories,omitempty"`
+	Scores        map[string]float64 `json:"scores,omitempty"`
+	Policy        string             `json:"policy"`
+	PolicyVersion string             `json:"policy_version"`
+	Rules         string             `json:"rules,omitempty"`
+	RulesVersion  string             `json:"rules_version,omitempty"`
+	Error         string             `json:"error,omitempty"`
+}
+
+// auditLog appends entries as JSON lines to a file that is only ever opened for appending.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open audit log")
+	}
+
+	return &auditLog{file: file}, nil
+}
+
+// append writes e and syncs it to disk before returning, so that an entry is never lost
+// for a decision that was already returned.
+func (a *auditLog) append(e AuditEntry) error {
+	if a == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit entry")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write audit entry")
+	}
+
+	return a.file.Sync()
+}
+
+func (a *auditLog) close() error {
+	if a == nil {
+		return nil
+	}
+
+	return a.file.Close()
+}
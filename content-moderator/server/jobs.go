@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+
+	// JobTTL is how long the response of a finished job can be fetched.
+	JobTTL = time.Hour
+	// MaxFinishedJobs caps the finished jobs kept, the oldest are dropped first.
+	MaxFinishedJobs = 10000
+)
+
+type job struct {
+	resp     Response
+	finished time.Time
+}
+
+// jobStore keeps the responses of async jobs in memory, they are lost on restart. Finished
+// jobs are dropped after JobTTL, or earlier once there are more than MaxFinishedJobs.
+type jobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	// finished holds the ids of finished jobs in the order they finished.
+	finished []string
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{
+		jobs: make(map[string]*job),
+	}
+}
+
+func (s *jobStore) put(resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evict(now)
+
+	j := &job{resp: resp}
+	if resp.Status != StatusPending {
+		j.finished = now
+		s.finished = append(s.finished, resp.ID)
+	}
+	s.jobs[resp.ID] = j
+
+	s.evict(now)
+}
+
+func (s *jobStore) get(id string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict(time.Now())
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return Response{}, false
+	}
+
+	return j.resp, true
+}
+
+func (s *jobStore) evict(now time.Time) {
+	drop := 0
+	for drop < len(s.finished) {
+		j, ok := s.jobs[s.finished[drop]]
+		if ok && now.Sub(j.finished) < JobTTL && len(s.finished)-drop <= MaxFinishedJobs {
+			break
+		}
+
+		delete(s.jobs, s.finished[drop])
+		drop++
+	}
+
+	s.finished = s.finished[drop:]
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
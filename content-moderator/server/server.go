@@ -0,0 +1,479 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"content-moderator/fileops"
+	"content-moderator/moderation"
+	"content-moderator/moderator"
+	"content-moderator/netguard"
+	"content-moderator/policy"
+	"content-moderator/webhook"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ShutdownTimeout = 30 * time.Second
+	MaxRequestBytes = 20 << 20
+	DefaultWorkers  = 4
+	DefaultMaxQueue = 100
+)
+
+type Config struct {
+	Addr string
+	// Policy decides when a request doesn't name a built-in profile.
+	Policy *policy.Profile
+	// AuditLog is the JSONL file every decision is appended to, empty disables it.
+	AuditLog string
+	// WebhookSecret signs webhook payloads when set.
+	WebhookSecret string
+	MaxImages     int
+	// Workers bounds the number of async jobs moderated at the same time.
+	Workers int
+	// MaxQueue bounds the async jobs accepted and not finished yet, further requests get 503.
+	MaxQueue int
+}
+
+type Server struct {
+	checker  moderator.Checker
+	cfg      Config
+	jobs     *jobStore
+	audit    *auditLog
+	webhooks *webhook.Client
+	// transport fetches the pages callers send, only from public addresses.
+	transport http.RoundTripper
+	workers   chan struct{}
+	queue     chan struct{}
+	inFlight  sync.WaitGroup
+	srv       *http.Server
+}
+
+// Response is the outcome of a moderation request, returned directly, by GET /jobs/{id}
+// and in webhook callbacks.
+type Response struct {
+	ID            string              `json:"id"`
+	Status        string              `json:"status"`
+	Source        string              `json:"source"`
+	Decision      *policy.Decision    `json:"decision,omitempty"`
+	Policy        string              `json:"policy"`
+	PolicyVersion string              `json:"policy_version"`
+	Results       []moderation.Result `json:"results,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// moderateRequest takes exactly one of Text, URL, ImageURL and File.
+type moderateRequest struct {
+	Text string `json:"text"`
+	// MultiLine moderates every line of Text on its own.
+	MultiLine  bool         `json:"multi_line"`
+	URL        string       `json:"url"`
+	ImageURL   string       `json:"image_url"`
+	File       *fileRequest `json:"file"`
+	Policy     string       `json:"policy"`
+	Async      bool         `json:"async"`
+	WebhookURL string       `json:"webhook_url"`
+}
+
+type fileRequest struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// imageURL is set for uploaded images, as a data URL.
+	imageURL string
+}
+
+func New(checker moderator.Checker, cfg Config) (*Server, error) {
+	if cfg.Policy == nil {
+		cfg.Policy = policy.Default()
+	}
+
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = DefaultMaxQueue
+	}
+
+	audit, err := openAuditLog(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := netguard.Transport()
+
+	s := &Server{
+		checker:   checker,
+		cfg:       cfg,
+		jobs:      newJobStore(),
+		audit:     audit,
+		webhooks:  webhook.New(cfg.WebhookSecret, transport),
+		transport: transport,
+		workers:   make(chan struct{}, cfg.Workers),
+		queue:     make(chan struct{}, cfg.MaxQueue),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /moderate", s.moderate)
+	mux.HandleFunc("GET /jobs/{id}", s.getJob)
+
+	s.srv = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Run serves until ctx is cancelled, then lets async jobs and their webhooks finish
+// before closing the audit log.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Content moderator listening on %s\n", s.srv.Addr)
+		errCh <- s.srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		s.audit.close()
+		return errors.Wrap(err, "server failed")
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shut down server")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Println("Stopped waiting for async jobs")
+	}
+
+	return s.audit.close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("failed to write response", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) moderate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBytes)
+
+	req, err := parseRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	source, collect, err := s.source(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile := s.cfg.Policy
+	if req.Policy != "" {
+		if !slices.Contains(policy.Builtin(), req.Policy) {
+			writeError(w, http.StatusBadRequest, "unknown policy, built-in policies: "+strings.Join(policy.Builtin(), ", "))
+			return
+		}
+
+		profile, err = policy.Load(req.Policy)
+		if err != nil {
+			log.Println("failed to load policy", err)
+			writeError(w, http.StatusInternalServerError, "failed to load policy")
+			return
+		}
+	}
+
+	if req.WebhookURL != "" && !req.Async {
+		writeError(w, http.StatusBadRequest, "webhook_url needs async")
+		return
+	}
+
+	if req.WebhookURL != "" {
+		if err := netguard.CheckURL(r.Context(), req.WebhookURL); err != nil {
+			writeError(w, http.StatusBadRequest, "webhook_url "+err.Error())
+			return
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		log.Println("failed to create job id", err)
+		writeError(w, http.StatusInternalServerError, "failed to create job")
+		return
+	}
+
+	if !req.Async {
+		resp := s.run(r.Context(), id, source, collect, profile)
+		status := http.StatusOK
+		if resp.Status == StatusFailed {
+			status = http.StatusBadGateway
+		}
+
+		writeJSON(w, status, resp)
+		return
+	}
+
+	select {
+	case s.queue <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "too many pending jobs, retry later")
+		return
+	}
+
+	pending := Response{
+		ID:            id,
+		Status:        StatusPending,
+		Source:        source,
+		Policy:        profile.Name,
+		PolicyVersion: profile.Version,
+	}
+	s.jobs.put(pending)
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		defer func() { <-s.queue }()
+
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+
+		// Jobs outlive the request, and are allowed to finish during shutdown.
+		ctx := context.Background()
+
+		resp := s.run(ctx, id, source, collect, profile)
+		s.jobs.put(resp)
+
+		if req.WebhookURL != "" {
+			if err := s.webhooks.Deliver(ctx, req.WebhookURL, resp); err != nil {
+				log.Printf("failed to deliver job %s: %v\n", id, err)
+			}
+		}
+	}()
+
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, pending)
+}
+
+// run moderates the collected content, decides with profile and records the decision
+// in the audit log.
+func (s *Server) run(
+	ctx context.Context,
+	id string,
+	source string,
+	collect func() (moderator.Input, error),
+	profile *policy.Profile,
+) Response {
+	resp := Response{
+		ID:            id,
+		Status:        StatusFailed,
+		Source:        source,
+		Policy:        profile.Name,
+		PolicyVersion: profile.Version,
+	}
+
+	entry := AuditEntry{
+		Time:          time.Now().UTC(),
+		ID:            id,
+		Source:        source,
+		Policy:        profile.Name,
+		PolicyVersion: profile.Version,
+	}
+
+	if s.checker.Rules != nil {
+		entry.Rules = s.checker.Rules.Name
+		entry.RulesVersion = s.checker.Rules.Version
+	}
+
+	in, err := collect()
+	if err == nil {
+		entry.InputHash = in.Hash()
+		checker := s.checker
+		checker.Policy = profile
+		resp.Results, err = checker.Run(ctx, in)
+	}
+
+	if err != nil {
+		log.Printf("failed to moderate %s: %v\n", id, err)
+		resp.Error = err.Error()
+		entry.Error = resp.Error
+	} else {
+		decision := profile.DecideAll(resp.Results)
+		resp.Status = StatusDone
+		resp.Decision = &decision
+
+		entry.Action = string(decision.Action)
+		entry.Reasons = decision.Reasons
+		entry.Categories, entry.Scores = aggregate(resp.Results)
+	}
+
+	if err := s.audit.append(entry); err != nil {
+		log.Printf("failed to audit %s: %v\n", id, err)
+	}
+
+	return resp
+}
+
+// source validates the request and returns a label for its source, and a function collecting
+// the content. Collecting is deferred, so that pages of async jobs are scraped in the job.
+// URLs must resolve to public addresses, and pages are fetched through the guarded transport.
+func (s *Server) source(ctx context.Context, req moderateRequest) (string, func() (moderator.Input, error), error) {
+	sources := 0
+	for _, set := range []bool{req.Text != "", req.URL != "", req.ImageURL != "", req.File != nil} {
+		if set {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return "", nil, errors.New("exactly one of text, url, image_url and file is required")
+	}
+
+	switch {
+	case req.Text != "" && req.MultiLine:
+		return "lines", func() (moderator.Input, error) { return moderator.FromLines(req.Text), nil }, nil
+
+	case req.Text != "":
+		return "text", func() (moderator.Input, error) { return moderator.FromText(req.Text), nil }, nil
+
+	case req.URL != "":
+		if err := netguard.CheckURL(ctx, req.URL); err != nil {
+			return "", nil, errors.Wrap(err, "url")
+		}
+
+		return "url:" + req.URL, func() (moderator.Input, error) { return moderator.FromURL(req.URL, s.cfg.MaxImages, s.transport) }, nil
+
+	case req.ImageURL != "":
+		if err := netguard.CheckURL(ctx, req.ImageURL); err != nil {
+			return "", nil, errors.Wrap(err, "image_url")
+		}
+
+		return "image_url:" + req.ImageURL, func() (moderator.Input, error) { return moderator.FromImage(req.ImageURL, req.ImageURL), nil }, nil
+
+	default:
+		name := req.File.Name
+		if name == "" {
+			name = "file"
+		}
+
+		if req.File.imageURL != "" {
+			return "file:" + name, func() (moderator.Input, error) { return moderator.FromImage(name, req.File.imageURL), nil }, nil
+		}
+
+		return "file:" + name, func() (moderator.Input, error) { return moderator.FromDocument(name, req.File.Content), nil }, nil
+	}
+}
+
+// parseRequest reads a JSON body, or a multipart form with the same fields and the file uploaded
+// as the "file" part.
+func parseRequest(r *http.Request) (moderateRequest, error) {
+	var req moderateRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, errors.New("invalid request body")
+		}
+
+		return req, nil
+	}
+
+	if err := r.ParseMultipartForm(MaxRequestBytes); err != nil {
+		return req, errors.New("invalid multipart form")
+	}
+
+	req.Text = r.FormValue("text")
+	req.URL = r.FormValue("url")
+	req.ImageURL = r.FormValue("image_url")
+	req.Policy = r.FormValue("policy")
+	req.WebhookURL = r.FormValue("webhook_url")
+	req.MultiLine, _ = strconv.ParseBool(r.FormValue("multi_line"))
+	req.Async, _ = strconv.ParseBool(r.FormValue("async"))
+
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return req, nil
+	}
+	if err != nil {
+		return req, errors.New("invalid file upload")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, errors.New("failed to read uploaded file")
+	}
+
+	req.File = &fileRequest{Name: header.Filename}
+	if imageURL, ok := fileops.ImageDataURL(data); ok {
+		req.File.imageURL = imageURL
+	} else {
+		req.File.Content = string(data)
+	}
+
+	return req, nil
+}
+
+// aggregate returns the categories flagged in any of the results and the highest score
+// of every category.
+func aggregate(results []moderation.Result) ([]string, map[string]float64) {
+	categories := make([]string, 0)
+	scores := make(map[string]float64)
+
+	for _, r := range results {
+		for _, c := range r.AllCategories() {
+			if !slices.Contains(categories, c) {
+				categories = append(categories, c)
+			}
+		}
+
+		for c, score := range r.Scores {
+			scores[c] = max(scores[c], score)
+		}
+	}
+
+	return categories, scores
+}
@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"content-moderator/moderation"
+
+	"github.com/pkg/errors"
+)
+
+type State struct {
+	Pages map[string]*PageState `json:"pages"`
+}
+
+// PageState is what the last check of a page found. Text and Hash are those of the last
+// moderated text, so a page is only moderated again once its text changes.
+type PageState struct {
+	Hash        string    `json:"hash"`
+	Text        string    `json:"text"`
+	CheckedAt   time.Time `json:"checked_at"`
+	ModeratedAt time.Time `json:"moderated_at"`
+	Flagged     []Finding `json:"flagged"`
+	// Error is set when the last check failed, the rest is kept from the check before.
+	Error string `json:"error,omitempty"`
+}
+
+// Finding is a flagged sentence of a page, a flagged chunk none of whose sentences is flagged
+// on its own, or a local rule match. Hash covers its normalised text and its categories.
+type Finding struct {
+	Hash       string               `json:"hash"`
+	Location   *moderation.Location `json:"location,omitempty"`
+	Categories []string             `json:"categories"`
+	// Action is the decision of the policy profile, when one is applied.
+	Action string `json:"action,omitempty"`
+	Text   string `json:"text"`
+}
+
+// ReadList reads the watched URLs, one per line. Blank lines and lines starting with # are
+// skipped, and so are repeated URLs.
+func ReadList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open watch list")
+	}
+	defer file.Close()
+
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+
+		seen[line] = true
+		urls = append(urls, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read watch list")
+	}
+
+	return urls, nil
+}
+
+// loadState reads the state file, a missing file is an empty state.
+func loadState(path string) (*State, error) {
+	state := &State{Pages: make(map[string]*PageState)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read watch state")
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.Wrap(err, "failed to parse watch state")
+	}
+
+	if state.Pages == nil {
+		state.Pages = make(map[string]*PageState)
+	}
+
+	return state, nil
+}
+
+// save replaces the state file through a rename, so a crash mid-write keeps the previous state.
+func (s *State) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode watch state")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write watch state")
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,357 @@
+// Package watch re-moderates a list of pages on a schedule. Only pages whose text changed
+// are moderated again, and the content flagged since the last check is reported.
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"content-moderator/moderation"
+	"content-moderator/moderator"
+	"content-moderator/policy"
+	"content-moderator/scraper"
+	"content-moderator/webhook"
+
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	// ListFile holds the watched URLs, it is read again before every check.
+	ListFile  string
+	StateFile string
+	// Interval between checks, 0 checks once.
+	Interval time.Duration
+	// WebhookURL receives a Report whenever a check finds newly flagged content.
+	WebhookURL    string
+	WebhookSecret string
+	// Policy decides which chunks count as flagged, nil follows the flags of the moderation.
+	Policy *policy.Profile
+}
+
+// Change is the difference between the last two moderations of a page.
+type Change struct {
+	URL string `json:"url"`
+	// New holds the findings that weren't there before, Resolved those no longer flagged.
+	New      []Finding `json:"new"`
+	Resolved []Finding `json:"resolved"`
+}
+
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Changes   []Change  `json:"changes"`
+}
+
+type Watcher struct {
+	checker  moderator.Checker
+	cfg      Config
+	webhooks *webhook.Client
+	out      io.Writer
+}
+
+// New returns a watcher that writes the changes it finds to out.
+func New(checker moderator.Checker, cfg Config, out io.Writer) *Watcher {
+	return &Watcher{
+		checker:  checker,
+		cfg:      cfg,
+		webhooks: webhook.New(cfg.WebhookSecret, nil),
+		out:      out,
+	}
+}
+
+// Run checks the watched pages every interval until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		report, err := w.Check(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := w.publish(ctx, report); err != nil {
+			log.Println("failed to publish watch report:", err)
+		}
+
+		if w.cfg.Interval <= 0 {
+			return nil
+		}
+
+		log.Printf("Next check in %s\n", w.cfg.Interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(w.cfg.Interval):
+		}
+	}
+}
+
+// Check scrapes every watched page once, moderates the pages whose text changed and saves
+// the state. Pages that fail to load are logged and checked again next time.
+func (w *Watcher) Check(ctx context.Context) (Report, error) {
+	urls, err := ReadList(w.cfg.ListFile)
+	if err != nil {
+		return Report{}, err
+	}
+
+	state, err := loadState(w.cfg.StateFile)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{CheckedAt: time.Now().UTC(), Changes: []Change{}}
+
+	watched := make(map[string]bool)
+	for _, url := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		watched[url] = true
+
+		page, ok := state.Pages[url]
+		if !ok {
+			page = &PageState{}
+			state.Pages[url] = page
+		}
+		page.CheckedAt = report.CheckedAt
+
+		change, changed, err := w.checkPage(ctx, url, page)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Printf("failed to check %s: %v\n", url, err)
+			page.Error = err.Error()
+			continue
+		}
+		page.Error = ""
+
+		if changed {
+			report.Changes = append(report.Changes, change)
+		}
+	}
+
+	for url := range state.Pages {
+		if !watched[url] && ctx.Err() == nil {
+			delete(state.Pages, url)
+		}
+	}
+
+	if err := state.save(w.cfg.StateFile); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// checkPage moderates the page at url when its text differs from page, and updates page.
+func (w *Watcher) checkPage(
+	ctx context.Context,
+	url string,
+	page *PageState,
+) (Change, bool, error) {
+	text, err := scraper.ScrapeURL(url)
+	if err != nil {
+		return Change{}, false, err
+	}
+
+	hash := hashOf(text)
+	if hash == page.Hash {
+		return Change{}, false, nil
+	}
+
+	results, err := w.checker.Run(ctx, moderator.FromDocument(url, text))
+	if err != nil {
+		return Change{}, false, err
+	}
+
+	flagged := w.findings(text, results)
+	change := diff(url, page.Flagged, flagged)
+
+	page.Hash = hash
+	page.Text = text
+	page.ModeratedAt = time.Now().UTC()
+	page.Flagged = flagged
+
+	return change, true, nil
+}
+
+// findings lists what is flagged on a page: the flagged sentences of every chunk, or the chunk
+// when none is flagged on its own, and the matches of the local rules.
+func (w *Watcher) findings(text string, results []moderation.Result) []Finding {
+	runes := []rune(text)
+
+	findings := make([]Finding, 0)
+	for _, r := range results {
+		if w.cfg.Policy != nil {
+			if w.cfg.Policy.Decide(r).Action == policy.Allow {
+				continue
+			}
+		} else if !r.Flagged {
+			continue
+		}
+
+		if w.checker.Flagged(r) {
+			flagged := r.Sentences
+			if len(flagged) == 0 {
+				flagged = []moderation.Result{r}
+			}
+
+			for _, f := range flagged {
+				f.Matches = nil
+				findings = append(findings, newFinding(f.Input, f.Location, f.Categories, w.action(f)))
+			}
+		}
+
+		offset := 0
+		if r.Location != nil {
+			offset = r.Location.Start
+		}
+
+		for _, m := range r.Matches {
+			if policy.Action(m.Action) == policy.Allow {
+				continue
+			}
+
+			start, end := offset+m.Start, offset+m.End
+			line, column := moderation.Position(runes, start)
+			location := &moderation.Location{Line: line, Column: column, Start: start, End: end}
+
+			action := ""
+			if w.cfg.Policy != nil {
+				action = m.Action
+			}
+
+			findings = append(findings, newFinding(string(runes[start:end]), location, []string{m.Label()}, action))
+		}
+	}
+
+	return findings
+}
+
+// newFinding identifies a finding by its text, with the whitespace normalised, and its
+// categories, so it is recognised when edits elsewhere on the page move it.
+func newFinding(
+	text string,
+	location *moderation.Location,
+	categories []string,
+	action string,
+) Finding {
+	sorted := slices.Clone(categories)
+	sort.Strings(sorted)
+
+	return Finding{
+		Hash:       hashOf(strings.Join(strings.Fields(text), " ") + "\n" + strings.Join(sorted, "\n")),
+		Location:   location,
+		Categories: categories,
+		Action:     action,
+		Text:       text,
+	}
+}
+
+func (w *Watcher) action(r moderation.Result) string {
+	if w.cfg.Policy == nil {
+		return ""
+	}
+
+	return string(w.cfg.Policy.Decide(r).Action)
+}
+
+func diff(url string, before, after []Finding) Change {
+	change := Change{URL: url, New: []Finding{}, Resolved: []Finding{}}
+
+	seen := make(map[string]bool)
+	for _, f := range before {
+		seen[f.Hash] = true
+	}
+
+	current := make(map[string]bool)
+	for _, f := range after {
+		current[f.Hash] = true
+		if !seen[f.Hash] {
+			change.New = append(change.New, f)
+		}
+	}
+
+	for _, f := range before {
+		if !current[f.Hash] {
+			change.Resolved = append(change.Resolved, f)
+		}
+	}
+
+	return change
+}
+
+// publish writes the changes, and posts the report to the webhook when content was newly flagged.
+func (w *Watcher) publish(ctx context.Context, report Report) error {
+	newlyFlagged := 0
+	for _, c := range report.Changes {
+		newlyFlagged += len(c.New)
+
+		if err := writeChange(w.out, c); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Checked watched pages: %d changed, %d new findings\n", len(report.Changes), newlyFlagged)
+
+	if w.cfg.WebhookURL == "" || newlyFlagged == 0 {
+		return nil
+	}
+
+	return errors.Wrap(w.webhooks.Deliver(ctx, w.cfg.WebhookURL, report), "failed to deliver watch report")
+}
+
+func writeChange(out io.Writer, c Change) error {
+	_, err := fmt.Fprintf(out, "%s changed: %d newly flagged, %d resolved\n", c.URL, len(c.New), len(c.Resolved))
+	if err != nil {
+		return err
+	}
+
+	for _, group := range []struct {
+		sign     string
+		findings []Finding
+	}{{"+", c.New}, {"-", c.Resolved}} {
+		for _, f := range group.findings {
+			where := ""
+			if f.Location != nil {
+				where = fmt.Sprintf(" line %d:%d", f.Location.Line, f.Location.Column)
+			}
+
+			labels := f.Categories
+			if f.Action != "" {
+				labels = append([]string{strings.ToUpper(f.Action)}, labels...)
+			}
+
+			_, err := fmt.Fprintf(out, "  %s%s [%s] %s\n", group.sign, where, strings.Join(labels, ", "), preview(f.Text))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(out)
+	return err
+}
+
+func preview(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > moderation.SpanPreviewLength {
+		return string(runes[:moderation.SpanPreviewLength]) + "..."
+	}
+
+	return text
+}
+
+func hashOf(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
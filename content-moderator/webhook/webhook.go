@@ -0,0 +1,88 @@
+// Package webhook posts JSON payloads to callback URLs, signed with a shared secret.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Attempts = 3
+	Timeout  = 10 * time.Second
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed with the webhook secret.
+	SignatureHeader = "X-Moderator-Signature"
+)
+
+type Client struct {
+	httpClient *http.Client
+	secret     []byte
+}
+
+// New returns a client that signs payloads with secret, empty leaves them unsigned. A nil
+// transport uses http.DefaultTransport.
+func New(secret string, transport http.RoundTripper) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: Timeout, Transport: transport},
+		secret:     []byte(secret),
+	}
+}
+
+// Deliver posts payload to url, retrying failed attempts with a growing delay.
+func (c *Client) Deliver(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook payload")
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt*attempt) * time.Second):
+			}
+		}
+
+		lastErr = c.post(ctx, url, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(lastErr, "webhook failed after %d attempts", Attempts)
+}
+
+func (c *Client) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(c.secret) > 0 {
+		mac := hmac.New(sha256.New, c.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,421 @@
+// Package embedcache is a content-addressed cache of embeddings shared by the RAG tools.
+// Embeddings are keyed by the embedder, e.g. its model, and a hash of the text, and stored in
+// a local bbolt file, so embedding the same text twice, in any of the tools, costs a single API call.
+package embedcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// EnvPath overrides the location of the cache file, "off" disables the cache.
+	EnvPath  = "EMBEDDING_CACHE_PATH"
+	Disabled = "off"
+
+	bucketName      = "embeddings"
+	statsBucketName = "stats"
+	// lockTimeout bounds the wait for another process's lookup or store.
+	lockTimeout = 5 * time.Second
+)
+
+var (
+	totalHitsKey   = []byte("hits")
+	totalMissesKey = []byte("misses")
+)
+
+// EmbedFunc embeds texts in order, it is only called for the texts missing from the cache.
+type EmbedFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+// Cache is safe for concurrent use. A nil *Cache is valid and caches nothing.
+//
+// The file is only held open while lookups or stores run, so the tools can share it. The calls
+// of one process share a single handle, they don't wait for each other's file lock. bbolt can't
+// lock parts of the file though: a call that waits longer than lockTimeout for another process
+// runs without the cache, and is counted as Busy.
+type Cache struct {
+	path string
+
+	mu    sync.Mutex
+	db    *bolt.DB
+	users int
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	busy   atomic.Int64
+	// unsaved counts the hits and misses not yet added to the totals in the file, they are
+	// written with the next store or Flush.
+	unsavedHits   atomic.Int64
+	unsavedMisses atomic.Int64
+}
+
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Busy counts the calls that ran without the cache because the file was locked.
+	Busy    int64
+	Entries int
+	// TotalHits and TotalMisses count across all runs of all tools. They are stored in the file
+	// with every call that stores embeddings, so they include runs that ended without logging
+	// their stats, unless all their lookups since were hits.
+	TotalHits   int64
+	TotalMisses int64
+}
+
+func hitRate(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
+
+func (s Stats) HitRate() float64 {
+	return hitRate(s.Hits, s.Misses)
+}
+
+func (s Stats) String() string {
+	str := fmt.Sprintf("%d hits, %d misses (%.0f%% hit rate), %d cached embeddings, %.0f%% hit rate over all runs",
+		s.Hits, s.Misses, s.HitRate()*100, s.Entries, hitRate(s.TotalHits, s.TotalMisses)*100)
+	if s.Busy > 0 {
+		str += fmt.Sprintf(", %d calls uncached while the file was locked", s.Busy)
+	}
+
+	return str
+}
+
+// DefaultPath is the cache file shared by all tools of the user, unless EMBEDDING_CACHE_PATH says otherwise.
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvPath); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find user cache directory")
+	}
+
+	return filepath.Join(dir, "rag-embeddings", "embeddings.db"), nil
+}
+
+// OpenDefault opens the cache at DefaultPath. It returns a nil cache when the cache is disabled.
+func OpenDefault() (*Cache, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if path == Disabled {
+		return nil, nil
+	}
+
+	return Open(path)
+}
+
+// Open creates the cache file when it is missing. The file isn't held open afterwards.
+func Open(path string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create embedding cache directory")
+	}
+
+	c := &Cache{path: path}
+
+	err := c.update(func(tx *bolt.Tx) error {
+		for _, name := range []string{bucketName, statsBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open embedding cache %s", path)
+	}
+
+	return c, nil
+}
+
+// acquire opens the file, or shares the handle of the calls already using it.
+func (c *Cache) acquire() (*bolt.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.db == nil {
+		db, err := bolt.Open(c.path, 0o600, &bolt.Options{Timeout: lockTimeout})
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	c.users++
+
+	return c.db, nil
+}
+
+// release closes the file once no call uses it, so that other processes can open it.
+func (c *Cache) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users--
+	if c.users == 0 {
+		_ = c.db.Close()
+		c.db = nil
+	}
+}
+
+func (c *Cache) view(fn func(tx *bolt.Tx) error) error {
+	db, err := c.acquire()
+	if err != nil {
+		return err
+	}
+	defer c.release()
+
+	return db.View(fn)
+}
+
+func (c *Cache) update(fn func(tx *bolt.Tx) error) error {
+	db, err := c.acquire()
+	if err != nil {
+		return err
+	}
+	defer c.release()
+
+	return db.Update(fn)
+}
+
+// Key addresses an embedding by the namespace of its embedder, e.g. the model, and its text.
+func Key(namespace, text string) []byte {
+	sum := sha256.Sum256([]byte(namespace + "\x00" + text))
+	return sum[:]
+}
+
+func (c *Cache) Get(namespace, text string) ([]float64, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	embeddings, err := c.lookup(namespace, []string{text})
+	if err != nil {
+		c.busy.Add(1)
+		return nil, false
+	}
+
+	if embeddings[0] == nil {
+		c.misses.Add(1)
+		c.unsavedMisses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	c.unsavedHits.Add(1)
+
+	return embeddings[0], true
+}
+
+func (c *Cache) Put(namespace, text string, embedding []float64) error {
+	if c == nil {
+		return nil
+	}
+
+	return c.store(namespace, []string{text}, [][]float64{embedding})
+}
+
+// lookup returns the cached embeddings of texts, nil for the missing ones.
+func (c *Cache) lookup(namespace string, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+
+	err := c.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		for i, t := range texts {
+			if v := b.Get(Key(namespace, t)); v != nil {
+				embeddings[i] = decode(v)
+			}
+		}
+		return nil
+	})
+
+	return embeddings, err
+}
+
+// store puts the embeddings of texts and adds the unsaved hits and misses to the totals.
+func (c *Cache) store(
+	namespace string,
+	texts []string,
+	embeddings [][]float64,
+) error {
+	hits, misses := c.unsavedHits.Swap(0), c.unsavedMisses.Swap(0)
+
+	err := c.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		for i, t := range texts {
+			if err := b.Put(Key(namespace, t), encode(embeddings[i])); err != nil {
+				return err
+			}
+		}
+
+		stats := tx.Bucket([]byte(statsBucketName))
+		if err := addCount(stats, totalHitsKey, hits); err != nil {
+			return err
+		}
+
+		return addCount(stats, totalMissesKey, misses)
+	})
+	if err != nil {
+		c.unsavedHits.Add(hits)
+		c.unsavedMisses.Add(misses)
+	}
+
+	return err
+}
+
+// Flush adds the hits and misses of lookups that needed no store to the totals in the file.
+func (c *Cache) Flush() error {
+	if c == nil || c.unsavedHits.Load()+c.unsavedMisses.Load() == 0 {
+		return nil
+	}
+
+	return c.store("", nil, nil)
+}
+
+// Embed returns the embeddings of texts, in order. Cached ones are read from the cache and
+// the others are embedded with a single call to embed, which runs without the file locked,
+// and stored.
+func (c *Cache) Embed(
+	ctx context.Context,
+	namespace string,
+	texts []string,
+	embed EmbedFunc,
+) ([][]float64, error) {
+	if c == nil {
+		return embed(ctx, texts)
+	}
+
+	embeddings, err := c.lookup(namespace, texts)
+	if err != nil {
+		c.busy.Add(1)
+		return embed(ctx, texts)
+	}
+
+	missing := make([]string, 0)
+	missingIdx := make(map[string][]int)
+
+	var hits, misses int64
+	for i, t := range texts {
+		if embeddings[i] != nil {
+			hits++
+			continue
+		}
+		misses++
+
+		// Duplicates within a call are embedded once.
+		if _, ok := missingIdx[t]; !ok {
+			missing = append(missing, t)
+		}
+		missingIdx[t] = append(missingIdx[t], i)
+	}
+
+	c.hits.Add(hits)
+	c.misses.Add(misses)
+	c.unsavedHits.Add(hits)
+	c.unsavedMisses.Add(misses)
+
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	fresh, err := embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fresh) != len(missing) {
+		return nil, errors.Errorf("expected %d embeddings, got %d", len(missing), len(fresh))
+	}
+
+	// The embeddings are returned even when they can't be stored, the cache only saves calls.
+	if err := c.store(namespace, missing, fresh); err != nil {
+		c.busy.Add(1)
+	}
+
+	for i, t := range missing {
+		for _, idx := range missingIdx[t] {
+			embeddings[idx] = fresh[i]
+		}
+	}
+
+	return embeddings, nil
+}
+
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Busy:   c.busy.Load(),
+	}
+
+	_ = c.view(func(tx *bolt.Tx) error {
+		stats.Entries = tx.Bucket([]byte(bucketName)).Stats().KeyN
+
+		totals := tx.Bucket([]byte(statsBucketName))
+		stats.TotalHits = count(totals, totalHitsKey) + c.unsavedHits.Load()
+		stats.TotalMisses = count(totals, totalMissesKey) + c.unsavedMisses.Load()
+		return nil
+	})
+
+	return stats
+}
+
+func count(b *bolt.Bucket, key []byte) int64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+
+	return int64(binary.LittleEndian.Uint64(v))
+}
+
+func addCount(b *bolt.Bucket, key []byte, n int64) error {
+	if n == 0 {
+		return nil
+	}
+
+	v := make([]byte, 8)
+	binary.LittleEndian.PutUint64(v, uint64(count(b, key)+n))
+
+	return b.Put(key, v)
+}
+
+// Embeddings are stored as little endian float64s, so that cached and fresh embeddings are identical.
+func encode(embedding []float64) []byte {
+	b := make([]byte, 8*len(embedding))
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(f))
+	}
+
+	return b
+}
+
+func decode(b []byte) []float64 {
+	embedding := make([]float64, len(b)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+	}
+
+	return embedding
+}
@@ -0,0 +1,10 @@
+module embedcache
+
+go 1.24.1
+
+require (
+	github.com/pkg/errors v0.9.1
+	go.etcd.io/bbolt v1.4.0
+)
+
+require golang.org/x/sys v0.29.0 // indirect
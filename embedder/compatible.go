@@ -0,0 +1,126 @@
+package embedder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const requestTimeout = 2 * time.Minute
+
+// Compatible embeds with any server implementing OpenAI's /v1/embeddings endpoint,
+// e.g. Ollama (http://localhost:11434/v1) or llama.cpp's server (http://localhost:8080/v1).
+type Compatible struct {
+	baseURL    string
+	model      string
+	apiKey     string
+	dimensions int
+	httpClient *http.Client
+}
+
+func NewCompatible(baseURL, model, apiKey string, dimensions int) *Compatible {
+	return &Compatible{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+		apiKey:     apiKey,
+		dimensions: dimensions,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (c *Compatible) Model() string {
+	return c.model
+}
+
+func (c *Compatible) Dimensions() int {
+	return c.dimensions
+}
+
+func (c *Compatible) Namespace() string {
+	return namespace(CompatibleProvider, c.baseURL, c.model, c.dimensions)
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (c *Compatible) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: c.model, Input: texts})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode embeddings request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create embeddings request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to call %s", c.baseURL)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read embeddings response")
+	}
+
+	var res embeddingsResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errors.Wrapf(err, "unexpected embeddings response (%s)", resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if res.Error != nil {
+			return nil, errors.Errorf("embeddings request failed (%s): %s", resp.Status, res.Error.Message)
+		}
+		return nil, errors.Errorf("embeddings request failed (%s)", resp.Status)
+	}
+
+	if len(res.Data) != len(texts) {
+		return nil, errors.Errorf("expected %d embeddings, got %d", len(texts), len(res.Data))
+	}
+
+	embeddings := make([][]float64, len(texts))
+	for _, d := range res.Data {
+		if err := setEmbedding(embeddings, d.Index, d.Embedding); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkComplete(embeddings); err != nil {
+		return nil, err
+	}
+
+	if c.dimensions > 0 {
+		for _, e := range embeddings {
+			if len(e) != c.dimensions {
+				return nil, errors.Errorf("%s returned %d dimensional embeddings, EMBEDDING_DIMENSIONS is %d", c.model, len(e), c.dimensions)
+			}
+		}
+	}
+
+	return embeddings, nil
+}
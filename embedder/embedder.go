@@ -0,0 +1,165 @@
+// Package embedder turns texts into embeddings for the RAG tools, either with OpenAI or with
+// any server that implements OpenAI's /v1/embeddings endpoint, e.g. Ollama or llama.cpp.
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"embedcache"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	OpenAIProvider     = "openai"
+	CompatibleProvider = "compatible"
+
+	// dimensionProbe is embedded once to learn the dimensions of models that don't declare them.
+	dimensionProbe = "dimension probe"
+)
+
+type Embedder interface {
+	// Embed returns the embeddings of texts, in order.
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	// Model names the model.
+	Model() string
+	// Namespace identifies the embeddings in the cache: the provider, its endpoint, the model
+	// and the dimensions, so that the same model name served elsewhere is never mixed up.
+	Namespace() string
+	// Dimensions is the length of the embeddings, 0 when it is only known after embedding.
+	Dimensions() int
+}
+
+// Config selects the embedding backend. Provider defaults to OpenAI, or to the compatible
+// provider when BaseURL is set.
+type Config struct {
+	Provider   string
+	BaseURL    string
+	Model      string
+	APIKey     string
+	Dimensions int
+}
+
+// New creates the embedder cfg selects. openaiAPIKey is used by the OpenAI provider
+// when cfg has no API key of its own.
+func New(cfg Config, openaiAPIKey string) (Embedder, error) {
+	provider := strings.ToLower(cfg.Provider)
+	if provider == "" {
+		provider = OpenAIProvider
+		if cfg.BaseURL != "" {
+			provider = CompatibleProvider
+		}
+	}
+
+	switch provider {
+	case OpenAIProvider:
+		apiKey := cfg.APIKey
+		if apiKey == "" {
+			apiKey = openaiAPIKey
+		}
+
+		return NewOpenAI(apiKey, cfg.Model), nil
+	case CompatibleProvider:
+		if cfg.BaseURL == "" {
+			return nil, errors.New("EMBEDDING_BASE_URL is required for the compatible provider, e.g. http://localhost:11434/v1")
+		}
+
+		if cfg.Model == "" {
+			return nil, errors.New("EMBEDDING_MODEL is required for the compatible provider, e.g. nomic-embed-text")
+		}
+
+		return NewCompatible(cfg.BaseURL, cfg.Model, cfg.APIKey, cfg.Dimensions), nil
+	default:
+		return nil, errors.Errorf("unknown embedding provider %q, allowed values: openai, compatible", cfg.Provider)
+	}
+}
+
+type cached struct {
+	Embedder
+	cache *embedcache.Cache
+}
+
+// WithCache reads and fills cache around e. A nil cache returns e unchanged.
+func WithCache(e Embedder, cache *embedcache.Cache) Embedder {
+	if cache == nil {
+		return e
+	}
+
+	return &cached{Embedder: e, cache: cache}
+}
+
+func (c *cached) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	return c.cache.Embed(ctx, c.Embedder.Namespace(), texts, c.Embedder.Embed)
+}
+
+func namespace(provider, baseURL, model string, dimensions int) string {
+	return fmt.Sprintf("%s %s %s %d", provider, baseURL, model, dimensions)
+}
+
+// Dimensions returns the length of e's embeddings, embedding a probe text when e doesn't declare it.
+func Dimensions(ctx context.Context, e Embedder) (int, error) {
+	if d := e.Dimensions(); d > 0 {
+		return d, nil
+	}
+
+	embeddings, err := e.Embed(ctx, []string{dimensionProbe})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to probe embedding dimensions")
+	}
+
+	return len(embeddings[0]), nil
+}
+
+// CheckDimensions fails when the vector column of a table can't hold e's embeddings.
+// tableDimensions is the declared size of the column, 0 skips the check.
+func CheckDimensions(ctx context.Context, e Embedder, table string, tableDimensions int) error {
+	if tableDimensions <= 0 {
+		return nil
+	}
+
+	d, err := Dimensions(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	if d != tableDimensions {
+		return errors.Errorf(
+			"%s produces %d dimensional embeddings but the embedding column of %q is vector(%d), recreate the table with vector(%d) or use a matching model",
+			e.Model(), d, table, tableDimensions, d)
+	}
+
+	return nil
+}
+
+// setEmbedding puts the embedding a server returned for index in place, the servers say which
+// text an embedding belongs to and can't be trusted to say it correctly.
+func setEmbedding(embeddings [][]float64, index int, embedding []float64) error {
+	if index < 0 || index >= len(embeddings) {
+		return errors.Errorf("embedding index %d out of range", index)
+	}
+
+	if embeddings[index] != nil {
+		return errors.Errorf("embedding index %d returned twice", index)
+	}
+
+	if len(embedding) == 0 {
+		return errors.Errorf("empty embedding for index %d", index)
+	}
+
+	embeddings[index] = embedding
+
+	return nil
+}
+
+// checkComplete fails when any text got no embedding.
+func checkComplete(embeddings [][]float64) error {
+	for i, e := range embeddings {
+		if e == nil {
+			return errors.Errorf("no embedding for text %d", i)
+		}
+	}
+
+	return nil
+}
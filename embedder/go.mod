@@ -0,0 +1,20 @@
+module embedder
+
+go 1.24.1
+
+require (
+	embedcache v0.0.0
+	github.com/openai/openai-go v0.1.0-beta.10
+	github.com/pkg/errors v0.9.1
+)
+
+require (
+	github.com/tidwall/gjson v1.14.4 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	github.com/tidwall/sjson v1.2.5 // indirect
+	go.etcd.io/bbolt v1.4.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
+
+replace embedcache => ../embedcache
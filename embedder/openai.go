@@ -0,0 +1,78 @@
+package embedder
+
+import (
+	"context"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultOpenAIModel      = openai.EmbeddingModelTextEmbeddingAda002
+	DefaultOpenAIDimensions = 1536
+
+	openAIBaseURL = "https://api.openai.com/v1"
+)
+
+// OpenAI embeds with OpenAI's embeddings API.
+type OpenAI struct {
+	client openai.Client
+	model  string
+}
+
+func NewOpenAI(apiKey, model string) *OpenAI {
+	if model == "" {
+		model = string(DefaultOpenAIModel)
+	}
+
+	return &OpenAI{
+		client: openai.NewClient(option.WithAPIKey(apiKey)),
+		model:  model,
+	}
+}
+
+func (o *OpenAI) Model() string {
+	return o.model
+}
+
+func (o *OpenAI) Dimensions() int {
+	if o.model == string(DefaultOpenAIModel) {
+		return DefaultOpenAIDimensions
+	}
+
+	return 0
+}
+
+func (o *OpenAI) Namespace() string {
+	return namespace(OpenAIProvider, openAIBaseURL, o.model, o.Dimensions())
+}
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	res, err := o.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: o.model,
+		Input: openai.EmbeddingNewParamsInputUnion{
+			OfArrayOfStrings: texts,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate embeddings")
+	}
+
+	if res == nil || len(res.Data) != len(texts) {
+		return nil, errors.New("failed to generate embeddings for every text")
+	}
+
+	embeddings := make([][]float64, len(texts))
+	for _, d := range res.Data {
+		if err := setEmbedding(embeddings, int(d.Index), d.Embedding); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkComplete(embeddings); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
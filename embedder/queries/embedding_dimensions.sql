@@ -0,0 +1,11 @@
+-- Create a function returning the declared size of a table's embedding column, e.g. 1536 for vector(1536)
+create or replace function embedding_dimensions (table_name text)
+returns int
+language sql stable
+as $$
+  select nullif(attribute.atttypmod, -1)
+  from pg_attribute attribute
+  where attribute.attrelid = table_name::regclass
+    and attribute.attname = 'embedding'
+    and not attribute.attisdropped;
+$$;
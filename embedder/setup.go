@@ -0,0 +1,100 @@
+package embedder
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"embedcache"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables every tool reads its embedding backend from.
+const (
+	EnvProvider   = "EMBEDDING_PROVIDER"
+	EnvBaseURL    = "EMBEDDING_BASE_URL"
+	EnvModel      = "EMBEDDING_MODEL"
+	EnvAPIKey     = "EMBEDDING_API_KEY"
+	EnvDimensions = "EMBEDDING_DIMENSIONS"
+)
+
+// ConfigFromEnv reads the EMBEDDING_* variables.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Provider: os.Getenv(EnvProvider),
+		BaseURL:  os.Getenv(EnvBaseURL),
+		Model:    os.Getenv(EnvModel),
+		APIKey:   os.Getenv(EnvAPIKey),
+	}
+
+	if v := os.Getenv(EnvDimensions); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			return Config{}, errors.Errorf("invalid %s %q, expected a number of dimensions", EnvDimensions, v)
+		}
+		cfg.Dimensions = d
+	}
+
+	return cfg, nil
+}
+
+// OpenCache opens the shared embedding cache. The tools keep working without it, so
+// failures are only logged.
+func OpenCache(logf func(format string, v ...any)) *embedcache.Cache {
+	cache, err := embedcache.OpenDefault()
+	if err != nil {
+		logf("Embedding cache disabled: %v\n", err)
+		return nil
+	}
+
+	return cache
+}
+
+// FromEnv creates the embedder the EMBEDDING_* variables select, OpenAI unless a local
+// server is configured, behind the shared embedding cache. The returned func saves the
+// hit totals of the run in the cache file and logs the cache's stats.
+func FromEnv(openaiAPIKey string, logf func(format string, v ...any)) (Embedder, func(), error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e, err := New(cfg, openaiAPIKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create embedder")
+	}
+
+	cache := OpenCache(logf)
+	logStats := func() {
+		if cache == nil {
+			return
+		}
+
+		if err := cache.Flush(); err != nil {
+			logf("Failed to save embedding cache totals: %v\n", err)
+		}
+		logf("Embedding cache: %s\n", cache.Stats())
+	}
+
+	return WithCache(e, cache), logStats, nil
+}
+
+// CheckTable fails when the embedding column of table can't hold e's embeddings.
+// readDimensions calls the embedding_dimensions function of queries/embedding_dimensions.sql,
+// databases without it are logged and not checked.
+func CheckTable(
+	ctx context.Context,
+	e Embedder,
+	table string,
+	readDimensions func(table string) (int, error),
+	logf func(format string, v ...any),
+) error {
+	tableDimensions, err := readDimensions(table)
+	if err != nil {
+		logf("skipping embedding dimension check for %s, run embedder/queries/embedding_dimensions.sql to enable it: %v\n", table, err)
+		return nil
+	}
+
+	return CheckDimensions(ctx, e, table, tableDimensions)
+}
@@ -3,9 +3,12 @@ module image-generator
 go 1.24.1
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible // indirect
-	github.com/openai/openai-go v0.1.0-beta.2 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
+	github.com/caarlos0/env v3.5.0+incompatible
+	github.com/openai/openai-go v0.1.0-beta.2
+	github.com/pkg/errors v0.9.1
+)
+
+require (
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"movie-chatbot/constants"
+	"movie-chatbot/memory"
+	"movie-chatbot/models"
+	"movie-chatbot/retrieval"
+	"movie-chatbot/rewriter"
+
+	"embedder"
+
+	supa "github.com/nedpals/supabase-go"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const (
+	MoviesSystemMessage        = `You are an enthusiastic movie expert who loves recommending movies to people. You will be given a conversation history, some context about movies, and a question. Your main job is to formulate a short answer to the question using the provided context and the conversation history. If the answer is not given in the context, try to find the answer in the conversation history. If you are unsure and cannot find the answer, say, "Sorry, I don't know the answer." Please do not make up the answer.`
+	UserMessageMovieSearchTmpl = `Context: %s, Question: %s`
+
+	Temperature      = 1.1
+	PresencePenalty  = 0.0
+	FrequencyPenalty = 0.0
+)
+
+type Config struct {
+	// Matches is the number of movies retrieved as context for each question.
+	Matches int
+	// Paraphrases is the number of alternative phrasings retrieved for, 0 disables multi-query retrieval.
+	Paraphrases int
+	// Embedder embeds the search queries, it may be backed by a local model.
+	Embedder embedder.Embedder
+}
+
+// Bot answers one turn of a conversation. It holds no conversation state itself,
+// so a single Bot can serve any number of sessions concurrently.
+type Bot struct {
+	openaiClient   openai.Client
+	supabaseClient *supa.Client
+	cfg            Config
+}
+
+func NewBot(
+	openaiClient openai.Client,
+	supabaseClient *supa.Client,
+	cfg Config,
+) *Bot {
+	return &Bot{
+		openaiClient:   openaiClient,
+		supabaseClient: supabaseClient,
+		cfg:            cfg,
+	}
+}
+
+// Reply answers input within the conversation held by mem and records the turn in it.
+// onToken, when not nil, is called with every piece of the answer as it is streamed.
+func (b *Bot) Reply(
+	ctx context.Context,
+	mem *memory.Memory,
+	input string,
+	onToken func(string) error,
+) (string, error) {
+	rewrite, err := rewriter.Condense(ctx, b.openaiClient, mem.Summary, mem.Turns, input, b.cfg.Paraphrases)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rewrite question")
+	}
+
+	matchedDocs, err := retrieval.MultiQuery(
+		ctx,
+		b.cfg.Embedder,
+		b.supabaseClient,
+		constants.MatchMoviesFunctionName,
+		rewrite.Queries(),
+		b.cfg.Matches)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to match movies for query")
+	}
+
+	combinedMatchResult := ""
+	for _, md := range matchedDocs {
+		combinedMatchResult = fmt.Sprintf("%s\n%s", combinedMatchResult, md.Content)
+	}
+
+	messages := mem.Messages(MoviesSystemMessage, fmt.Sprintf(UserMessageMovieSearchTmpl, combinedMatchResult, input))
+
+	stream := b.openaiClient.Chat.Completions.NewStreaming(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages:         messages,
+			Model:            openai.ChatModelGPT4,
+			Temperature:      param.NewOpt(Temperature),
+			PresencePenalty:  param.NewOpt(PresencePenalty),
+			FrequencyPenalty: param.NewOpt(FrequencyPenalty),
+		})
+	defer stream.Close()
+
+	var sb strings.Builder
+	for stream.Next() {
+		chunk := stream.Current()
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		sb.WriteString(token)
+
+		if onToken != nil {
+			if err := onToken(token); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return "", errors.Wrap(err, "failed to generate movies response")
+	}
+
+	answer := sb.String()
+
+	mem.Add(models.Turn{Question: input, Answer: answer})
+	if err := mem.Compact(ctx, b.openaiClient); err != nil {
+		return "", errors.Wrap(err, "failed to compact conversation memory")
+	}
+
+	return answer, nil
+}
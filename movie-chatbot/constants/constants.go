@@ -5,4 +5,6 @@ const (
 	MoviesTblName              = "movies"
 	MatchMoviesFunctionName    = "match_movies"
 	MoviesTblContentColumnName = "content"
+
+	EmbeddingDimensionsFunctionName = "embedding_dimensions"
 )
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -10,27 +11,19 @@ import (
 	"strings"
 	"syscall"
 
+	"movie-chatbot/chat"
 	"movie-chatbot/constants"
+	"movie-chatbot/memory"
 	openaipkg "movie-chatbot/openai"
+	"movie-chatbot/server"
 	"movie-chatbot/supabase"
 
+	"embedder"
+
 	"github.com/caarlos0/env"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/packages/param"
 	"github.com/pkg/errors"
 )
 
-const (
-	MoviesSystemMessage                    = `You are an enthusiastic movie expert who loves recommending movies to people. You will be given a conversation history, some context about movies, and a question. Your main job is to formulate a short answer to the question using the provided context and the conversation history. If the answer is not given in the context, try to find the answer in the conversation history. If you are unsure and cannot find the answer, say, "Sorry, I don't know the answer." Please do not make up the answer.`
-	UserMessageMovieSearchTmpl             = `Context: %s, Question: %s`
-	CheckUserMessageKindSystemMessage      = `Based on the input from user check whether it is a follow up question or movie related question. Answer 'yes' if it is a follow up question or not a movie related question. Answer 'no' otherwise`
-	LookupConversationHistorySystemMessage = `Look up in the conversation history and find answer to user question`
-
-	Temperature      = 1.1
-	PresencePenalty  = 0.0
-	FrequencyPenalty = 0.0
-)
-
 type envvars struct {
 	OpenApiKey         string `env:"OPEN_API_KEY"`
 	SupabaseApiKey     string `env:"SUPABASE_API_KEY"`
@@ -46,6 +39,75 @@ func main() {
 		log.Fatalln("failed to parse env variables", errors.Wrap(err, "missing required env"))
 	}
 
+	matchesFlag := flag.Int(
+		"matches",
+		2,
+		"number of movies retrieved as context for each question")
+	paraphrasesFlag := flag.Int(
+		"paraphrases",
+		0,
+		"number of alternative phrasings of the search query retrieved for, 0 disables multi-query retrieval and skips the rewrite call for the first question")
+	sessionFlag := flag.String(
+		"session",
+		"",
+		"name of the session to resume and save the conversation to, empty keeps it in memory only")
+	sessionsDirFlag := flag.String(
+		"sessions-dir",
+		"sessions",
+		"directory where sessions are saved, in server mode empty keeps them in memory only")
+	memoryTokensFlag := flag.Int(
+		"memory-tokens",
+		2000,
+		"token budget of the remembered turns, older turns are summarized once it is exceeded")
+	serveFlag := flag.Bool(
+		"serve",
+		false,
+		"serve the web chat and HTTP API instead of chatting on the command line")
+	addrFlag := flag.String(
+		"addr",
+		":8080",
+		"address the server listens on")
+	flag.Parse()
+
+	matches := 2
+	if matchesFlag != nil {
+		matches = *matchesFlag
+	}
+
+	paraphrases := 0
+	if paraphrasesFlag != nil {
+		paraphrases = *paraphrasesFlag
+	}
+
+	sessionsDir := "sessions"
+	if sessionsDirFlag != nil {
+		sessionsDir = *sessionsDirFlag
+	}
+
+	sessionPath := ""
+	if sessionFlag != nil && *sessionFlag != "" {
+		var err error
+		sessionPath, err = memory.SessionPath(sessionsDir, *sessionFlag)
+		if err != nil {
+			log.Fatalln("failed to resolve session", err)
+		}
+	}
+
+	memoryTokens := 2000
+	if memoryTokensFlag != nil {
+		memoryTokens = *memoryTokensFlag
+	}
+
+	serve := false
+	if serveFlag != nil {
+		serve = *serveFlag
+	}
+
+	addr := ":8080"
+	if addrFlag != nil {
+		addr = *addrFlag
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
@@ -59,16 +121,58 @@ func main() {
 	openaiClient := openaipkg.NewOpenAiClient(envs.OpenApiKey)
 	supabaseClient := supabase.NewClient(envs.SupabaseProjectUrl, envs.SupabaseApiKey)
 
+	emb, logCacheStats, err := embedder.FromEnv(envs.OpenApiKey, log.Printf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logCacheStats()
+
+	readDimensions := func(table string) (int, error) {
+		return supabase.ReadEmbeddingDimensions(supabaseClient, table)
+	}
+	if err := embedder.CheckTable(ctx, emb, constants.MoviesTblName, readDimensions, log.Printf); err != nil {
+		log.Fatalln(err)
+	}
+
+	bot := chat.NewBot(openaiClient, supabaseClient, chat.Config{
+		Matches:     matches,
+		Paraphrases: paraphrases,
+		Embedder:    emb,
+	})
+
+	if serve {
+		srv, err := server.New(bot, server.Config{
+			Addr:         addr,
+			MemoryTokens: memoryTokens,
+			SessionsDir:  sessionsDir,
+		})
+		if err != nil {
+			log.Fatalln("failed to create server", err)
+		}
+
+		if err := srv.Run(ctx); err != nil {
+			log.Fatalln("failed to run server", err)
+		}
+
+		log.Println("Movie chatbot server stopped.")
+		return
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 
-	messages := []openai.ChatCompletionMessageParamUnion{
-		{
-			OfSystem: &openai.ChatCompletionSystemMessageParam{
-				Content: openai.ChatCompletionSystemMessageParamContentUnion{
-					OfString: openai.String(MoviesSystemMessage),
-				},
-			},
-		},
+	mem, err := memory.New(memoryTokens)
+	if err != nil {
+		log.Fatalln("failed to create conversation memory", err)
+	}
+
+	if sessionPath != "" {
+		if err := mem.Load(sessionPath); err != nil {
+			log.Fatalln("failed to load session", err)
+		}
+
+		if len(mem.Turns) > 0 || mem.Summary != "" {
+			log.Printf("Resumed session %q with %d remembered turns.\n", *sessionFlag, len(mem.Turns))
+		}
 	}
 
 	log.Println("Movie chatbot started. Press Ctrl+C to exit.")
@@ -113,127 +217,18 @@ func main() {
 					continue
 				}
 
-				if isFollowUpQuestion(ctx, openaiClient, input) {
-					resp := answerConversationHistorySpecificQuestion(ctx, openaiClient, input, messages)
-					log.Println(resp)
-					continue
-				}
-
-				res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-					Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-					Input: openai.EmbeddingNewParamsInputUnion{
-						OfString: openai.String(input),
-					},
-				})
+				answer, err := bot.Reply(ctx, mem, input, nil)
 				if err != nil {
-					log.Fatalln("failed to generate embeddings", err)
+					log.Fatalln("failed to answer question", err)
 				}
+				log.Println(answer)
 
-				if res != nil && len(res.Data) > 0 {
-					matchedDocs, err := supabase.InvokeMatchFunction(supabaseClient, constants.MatchMoviesFunctionName, res.Data[0].Embedding, 1)
-					if err != nil {
-						log.Fatalln("failed to match movies for query", err)
+				if sessionPath != "" {
+					if err := mem.Save(sessionPath); err != nil {
+						log.Fatalln("failed to save session", err)
 					}
-
-					if len(matchedDocs) == 0 {
-						log.Fatalln("invalid number of matching movies found")
-					}
-
-					combinedMatchResult := ""
-					for _, md := range matchedDocs {
-						combinedMatchResult = fmt.Sprintf("%s\n%s", combinedMatchResult, md.Content)
-					}
-
-					messages = append(messages, openai.ChatCompletionMessageParamUnion{
-						OfUser: &openai.ChatCompletionUserMessageParam{
-							Content: openai.ChatCompletionUserMessageParamContentUnion{
-								OfString: openai.String(fmt.Sprintf(UserMessageMovieSearchTmpl, combinedMatchResult, input)),
-							},
-						},
-					})
-
-					chatResp, err := openaiClient.Chat.Completions.New(
-						ctx,
-						openai.ChatCompletionNewParams{
-							Messages:         messages,
-							Model:            openai.ChatModelGPT4,
-							Temperature:      param.NewOpt(Temperature),
-							PresencePenalty:  param.NewOpt(PresencePenalty),
-							FrequencyPenalty: param.NewOpt(FrequencyPenalty),
-						})
-					if err != nil {
-						log.Fatalln("failed to generate movies response", err)
-					}
-
-					log.Println(chatResp.Choices[0].Message.Content)
-
-					messages = append(messages, openai.ChatCompletionMessageParamUnion{
-						OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-							Content: openai.ChatCompletionAssistantMessageParamContentUnion{
-								OfString: openai.String(chatResp.Choices[0].Message.Content),
-							},
-						},
-					})
-				} else {
-					log.Fatalln("failed to generate embeddings for query", err)
 				}
 			}
 		}
 	}
 }
-
-func isFollowUpQuestion(
-	ctx context.Context,
-	openaiClient openai.Client,
-	input string) bool {
-	resp := singleChatCompletion(ctx, openaiClient, input, CheckUserMessageKindSystemMessage, nil)
-	return strings.ToLower(resp) == "yes"
-}
-
-func answerConversationHistorySpecificQuestion(
-	ctx context.Context,
-	openaiClient openai.Client,
-	input string,
-	historicalMessages []openai.ChatCompletionMessageParamUnion) string {
-	return singleChatCompletion(ctx, openaiClient, input, LookupConversationHistorySystemMessage, historicalMessages)
-}
-
-func singleChatCompletion(
-	ctx context.Context,
-	openaiClient openai.Client,
-	input, systemMessage string,
-	historicalMessages []openai.ChatCompletionMessageParamUnion) string {
-	messages := []openai.ChatCompletionMessageParamUnion{
-		{
-			OfSystem: &openai.ChatCompletionSystemMessageParam{
-				Content: openai.ChatCompletionSystemMessageParamContentUnion{
-					OfString: openai.String(systemMessage),
-				},
-			},
-		},
-	}
-
-	if len(historicalMessages) > 0 {
-		messages = append(messages, historicalMessages...)
-	}
-
-	messages = append(messages, openai.ChatCompletionMessageParamUnion{
-		OfUser: &openai.ChatCompletionUserMessageParam{
-			Content: openai.ChatCompletionUserMessageParamContentUnion{
-				OfString: openai.String(input),
-			},
-		},
-	})
-
-	chatResp, err := openaiClient.Chat.Completions.New(
-		ctx,
-		openai.ChatCompletionNewParams{
-			Messages: messages,
-			Model:    openai.ChatModelGPT4,
-		})
-	if err != nil {
-		log.Fatalln("failed to chat response:", err)
-	}
-
-	return chatResp.Choices[0].Message.Content
-}
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"movie-chatbot/models"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	SummarizeSystemMessage = `You maintain a running summary of a conversation between a user and a movie recommendation assistant. You will be given the current summary and some older turns of the conversation. Write an updated summary in at most 150 words that keeps facts about the user (name, tastes, constraints), every movie that was recommended or discussed and any open questions. Reply only with the summary.`
+	SummaryMessageTmpl     = `Summary of the earlier conversation: %s`
+
+	// MinRecentTurns are never summarized, so the latest exchange is always available verbatim.
+	MinRecentTurns = 2
+
+	// Approximate per message overhead of the chat format.
+	messageTokenOverhead = 4
+)
+
+func init() {
+	// Use the embedded BPE ranks instead of downloading them on first use.
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// Memory keeps the recent turns of a conversation verbatim and a rolling summary of older ones.
+// Retrieved context is never stored, it is only sent along with the latest question.
+type Memory struct {
+	Summary string        `json:"summary"`
+	Turns   []models.Turn `json:"turns"`
+
+	maxTokens int
+	encoder   *tiktoken.Tiktoken
+}
+
+func New(maxTokens int) (*Memory, error) {
+	encoder, err := tiktoken.EncodingForModel(string(openai.ChatModelGPT4))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load tokenizer")
+	}
+
+	return &Memory{
+		Turns:     make([]models.Turn, 0),
+		maxTokens: maxTokens,
+		encoder:   encoder,
+	}, nil
+}
+
+func (m *Memory) Add(turn models.Turn) {
+	m.Turns = append(m.Turns, turn)
+}
+
+func (m *Memory) CountTokens(text string) int {
+	return len(m.encoder.Encode(text, nil, nil)) + messageTokenOverhead
+}
+
+func (m *Memory) turnsTokens(turns []models.Turn) int {
+	total := 0
+	for _, t := range turns {
+		total += m.CountTokens(t.Question) + m.CountTokens(t.Answer)
+	}
+
+	return total
+}
+
+// Messages builds the chat request: the system prompt with the summary, the remembered turns
+// without their retrieved context, and the latest question with the freshly retrieved context.
+func (m *Memory) Messages(
+	systemMessage string,
+	latestUserMessage string,
+) []openai.ChatCompletionMessageParamUnion {
+	if m.Summary != "" {
+		systemMessage = systemMessage + "\n\n" + fmt.Sprintf(SummaryMessageTmpl, m.Summary)
+	}
+
+	messages := []openai.ChatCompletionMessageParamUnion{
+		{
+			OfSystem: &openai.ChatCompletionSystemMessageParam{
+				Content: openai.ChatCompletionSystemMessageParamContentUnion{
+					OfString: openai.String(systemMessage),
+				},
+			},
+		},
+	}
+
+	for _, t := range m.Turns {
+		messages = append(messages,
+			openai.ChatCompletionMessageParamUnion{
+				OfUser: &openai.ChatCompletionUserMessageParam{
+					Content: openai.ChatCompletionUserMessageParamContentUnion{
+						OfString: openai.String(t.Question),
+					},
+				},
+			},
+			openai.ChatCompletionMessageParamUnion{
+				OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+					Content: openai.ChatCompletionAssistantMessageParamContentUnion{
+						OfString: openai.String(t.Answer),
+					},
+				},
+			})
+	}
+
+	messages = append(messages, openai.ChatCompletionMessageParamUnion{
+		OfUser: &openai.ChatCompletionUserMessageParam{
+			Content: openai.ChatCompletionUserMessageParamContentUnion{
+				OfString: openai.String(latestUserMessage),
+			},
+		},
+	})
+
+	return messages
+}
+
+// Compact folds the oldest turns into the summary until the remembered turns fit into the token budget.
+func (m *Memory) Compact(
+	ctx context.Context,
+	openaiClient openai.Client,
+) error {
+	if m.turnsTokens(m.Turns) <= m.maxTokens || len(m.Turns) <= MinRecentTurns {
+		return nil
+	}
+
+	cut := 0
+	for cut < len(m.Turns)-MinRecentTurns && m.turnsTokens(m.Turns[cut:]) > m.maxTokens {
+		cut++
+	}
+
+	var sb strings.Builder
+	for _, t := range m.Turns[:cut] {
+		sb.WriteString(fmt.Sprintf("User: %s\nAssistant: %s\n", t.Question, t.Answer))
+	}
+
+	chatResp, err := openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(SummarizeSystemMessage),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf("Current summary: %s\n\nOlder turns:\n%s", m.Summary, sb.String())),
+						},
+					},
+				},
+			},
+			Model:       openai.ChatModelGPT4o,
+			Temperature: param.NewOpt(0.0),
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to summarize conversation")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return errors.New("empty summary response")
+	}
+
+	m.Summary = strings.TrimSpace(chatResp.Choices[0].Message.Content)
+	m.Turns = append(make([]models.Turn, 0, len(m.Turns)-cut), m.Turns[cut:]...)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var validSessionName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func SessionPath(dir, name string) (string, error) {
+	if !validSessionName.MatchString(name) {
+		return "", errors.Errorf("invalid session name %q, use letters, digits, '-' and '_'", name)
+	}
+
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Load restores the summary and turns saved at path. A missing file is a new, empty session.
+func (m *Memory) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read session")
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return errors.Wrap(err, "failed to parse session")
+	}
+
+	return nil
+}
+
+// Save writes the session to a temporary file first, so an interrupted write never corrupts it.
+func (m *Memory) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create sessions directory")
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode session")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write session")
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -4,3 +4,8 @@ type Vector struct {
 	Content   string    `json:"content"`
 	Embedding []float64 `json:"embedding"`
 }
+
+type Turn struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
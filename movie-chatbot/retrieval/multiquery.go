@@ -0,0 +1,71 @@
+package retrieval
+
+import (
+	"context"
+	"sort"
+
+	"movie-chatbot/models/db"
+	"movie-chatbot/supabase"
+
+	"embedder"
+
+	supa "github.com/nedpals/supabase-go"
+	"github.com/pkg/errors"
+)
+
+// RRFConstant dampens the weight of the top ranks, 60 is the value used in the original paper.
+// https://plg.uwaterloo.ca/~gvcormac/cormacksigir09-rrf.pdf
+const RRFConstant = 60.0
+
+// MultiQuery embeds all queries in a single request, retrieves matches for each of them
+// and merges the result lists with reciprocal rank fusion.
+func MultiQuery(
+	ctx context.Context,
+	emb embedder.Embedder,
+	supabaseClient *supa.Client,
+	functionName string,
+	queries []string,
+	numMatches int,
+) ([]db.MatchedDocument, error) {
+	embeddings, err := emb.Embed(ctx, queries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to embed queries")
+	}
+
+	scores := make(map[int]float64)
+	docs := make(map[int]db.MatchedDocument)
+
+	for _, e := range embeddings {
+		matches, err := supabase.InvokeMatchFunction(supabaseClient, functionName, e, numMatches)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to match movies for query")
+		}
+
+		for rank, md := range matches {
+			scores[md.ID] += 1 / (RRFConstant + float64(rank+1))
+
+			if d, ok := docs[md.ID]; !ok || md.Similarity > d.Similarity {
+				docs[md.ID] = md
+			}
+		}
+	}
+
+	merged := make([]db.MatchedDocument, 0, len(docs))
+	for _, d := range docs {
+		merged = append(merged, d)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if scores[merged[i].ID] != scores[merged[j].ID] {
+			return scores[merged[i].ID] > scores[merged[j].ID]
+		}
+
+		return merged[i].Similarity > merged[j].Similarity
+	})
+
+	if len(merged) > numMatches {
+		merged = merged[:numMatches]
+	}
+
+	return merged, nil
+}
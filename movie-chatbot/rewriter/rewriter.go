@@ -0,0 +1,111 @@
+package rewriter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"movie-chatbot/models"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const CondenseSystemMessage = `You rewrite the latest message of a conversation about movies into a standalone search query for a movie database. Resolve pronouns and references such as "it", "that one" or "any shorter ones?" using the conversation history, and keep every constraint the user mentioned. If the message does not need the database, e.g. "What is my name?", still rewrite it as well as you can. Also write %d alternative phrasings of the standalone query that use different words. Reply only with JSON in the form {"query": "<standalone query>", "paraphrases": ["<paraphrase>", ...]}.`
+
+type Rewrite struct {
+	Query       string   `json:"query"`
+	Paraphrases []string `json:"paraphrases"`
+}
+
+// Queries returns the standalone query followed by its distinct paraphrases.
+func (r Rewrite) Queries() []string {
+	queries := []string{r.Query}
+	seen := map[string]bool{strings.ToLower(r.Query): true}
+
+	for _, p := range r.Paraphrases {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[strings.ToLower(p)] {
+			continue
+		}
+
+		seen[strings.ToLower(p)] = true
+		queries = append(queries, p)
+	}
+
+	return queries
+}
+
+// Condense turns the latest message plus history into a standalone query and paraphrases of it.
+// The first message of a conversation is already standalone, so when no paraphrases are asked
+// for either, it is returned without a model call. Otherwise the call still writes the paraphrases.
+func Condense(
+	ctx context.Context,
+	openaiClient openai.Client,
+	summary string,
+	history []models.Turn,
+	input string,
+	numParaphrases int,
+) (Rewrite, error) {
+	if summary == "" && len(history) == 0 && numParaphrases == 0 {
+		return Rewrite{Query: input}, nil
+	}
+
+	var sb strings.Builder
+	if summary != "" {
+		sb.WriteString(fmt.Sprintf("Summary of earlier turns: %s\n", summary))
+	}
+	for _, t := range history {
+		sb.WriteString(fmt.Sprintf("User: %s\nAssistant: %s\n", t.Question, t.Answer))
+	}
+
+	chatResp, err := openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf(CondenseSystemMessage, numParaphrases)),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf("Conversation history:\n%s\nLatest message: %s", sb.String(), input)),
+						},
+					},
+				},
+			},
+			Model:       openai.ChatModelGPT4o,
+			Temperature: param.NewOpt(0.0),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &openai.ResponseFormatJSONObjectParam{},
+			},
+		})
+	if err != nil {
+		return Rewrite{}, errors.Wrap(err, "failed to condense question")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return Rewrite{}, errors.New("empty condense response")
+	}
+
+	var rewrite Rewrite
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &rewrite); err != nil {
+		return Rewrite{}, errors.Wrap(err, "failed to parse condense response")
+	}
+
+	if strings.TrimSpace(rewrite.Query) == "" {
+		rewrite.Query = input
+	}
+
+	if len(rewrite.Paraphrases) > numParaphrases {
+		rewrite.Paraphrases = rewrite.Paraphrases[:numParaphrases]
+	}
+
+	return rewrite, nil
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"movie-chatbot/chat"
+	"movie-chatbot/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ShutdownTimeout = 10 * time.Second
+	MaxMessageBytes = 4 << 10
+	// MaxSessions caps the sessions kept in memory.
+	MaxSessions        = 1000
+	SessionIdleTimeout = 30 * time.Minute
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+type Config struct {
+	Addr         string
+	MemoryTokens int
+	// SessionsDir persists every session after each turn, empty keeps them in memory only.
+	SessionsDir string
+}
+
+type Server struct {
+	bot      *chat.Bot
+	sessions *sessionStore
+	srv      *http.Server
+}
+
+func New(bot *chat.Bot, cfg Config) (*Server, error) {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load static files")
+	}
+
+	s := &Server{
+		bot:      bot,
+		sessions: newSessionStore(cfg.MemoryTokens, cfg.SessionsDir),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("POST /api/sessions", s.createSession)
+	mux.HandleFunc("GET /api/sessions/{id}", s.getSession)
+	mux.HandleFunc("POST /api/sessions/{id}/messages", s.postMessage)
+
+	s.srv = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Run serves until ctx is cancelled and then waits for in-flight replies to finish.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Movie chatbot listening on %s\n", s.srv.Addr)
+		errCh <- s.srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return errors.Wrap(err, "server failed")
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shut down server")
+	}
+
+	return nil
+}
+
+type sessionResponse struct {
+	ID      string        `json:"id"`
+	Summary string        `json:"summary,omitempty"`
+	Turns   []models.Turn `json:"turns"`
+}
+
+type messageRequest struct {
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("failed to write response", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	id, err := s.sessions.create()
+	if errors.Is(err, errTooManySessions) {
+		writeError(w, http.StatusServiceUnavailable, "too many active sessions, try again later")
+		return
+	}
+	if err != nil {
+		log.Println("failed to create session", err)
+		writeError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sessionResponse{ID: id, Turns: []models.Turn{}})
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	sess, ok := s.getSessionOrFail(w, id)
+	if !ok {
+		return
+	}
+	defer s.sessions.release(sess)
+
+	sess.mu.Lock()
+	resp := sessionResponse{
+		ID:      id,
+		Summary: sess.mem.Summary,
+		Turns:   append([]models.Turn{}, sess.mem.Turns...),
+	}
+	sess.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// getSessionOrFail writes the error response when the session with id can't be used.
+func (s *Server) getSessionOrFail(w http.ResponseWriter, id string) (*session, bool) {
+	sess, ok, err := s.sessions.get(id)
+	if errors.Is(err, errTooManySessions) {
+		writeError(w, http.StatusServiceUnavailable, "too many active sessions, try again later")
+		return nil, false
+	}
+	if err != nil {
+		log.Println("failed to load session", err)
+		writeError(w, http.StatusInternalServerError, "failed to load session")
+		return nil, false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "session not found")
+		return nil, false
+	}
+
+	return sess, true
+}
+
+// postMessage answers a message and streams the answer as server-sent events:
+// "token" events carry pieces of the answer, followed by a single "done" or "error" event.
+func (s *Server) postMessage(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req messageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxMessageBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	input := strings.TrimSpace(req.Message)
+	if input == "" {
+		writeError(w, http.StatusBadRequest, "message is empty")
+		return
+	}
+
+	sess, ok := s.getSessionOrFail(w, id)
+	if !ok {
+		return
+	}
+	defer s.sessions.release(sess)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// a failed reply may have added its turn already, it is rolled back to match the saved session
+	turns, summary := slices.Clone(sess.mem.Turns), sess.mem.Summary
+
+	answer, err := s.bot.Reply(r.Context(), sess.mem, input, func(token string) error {
+		if err := writeEvent(w, "token", token); err != nil {
+			return err
+		}
+		flusher.Flush()
+
+		return nil
+	})
+	if err != nil {
+		sess.mem.Turns, sess.mem.Summary = turns, summary
+
+		log.Println("failed to answer message", err)
+		writeEvent(w, "error", "failed to answer message")
+		flusher.Flush()
+		return
+	}
+
+	if err := s.sessions.save(id, sess); err != nil {
+		log.Println("failed to save session", err)
+	}
+
+	writeEvent(w, "done", answer)
+	flusher.Flush()
+}
+
+// writeEvent encodes data as JSON so that newlines in the answer cannot break the event framing.
+func writeEvent(w http.ResponseWriter, event, data string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+
+	return err
+}
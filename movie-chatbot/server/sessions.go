@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"movie-chatbot/memory"
+
+	"github.com/pkg/errors"
+)
+
+var errTooManySessions = errors.New("too many sessions")
+
+// session serializes the turns of one conversation, other sessions are not blocked by it.
+type session struct {
+	mu  sync.Mutex
+	mem *memory.Memory
+	// lastUsed and refs, the requests using the session, are guarded by the store's mutex.
+	lastUsed time.Time
+	refs     int
+}
+
+// sessionStore keeps at most MaxSessions sessions in memory. Sessions no request uses are
+// evicted once idle for SessionIdleTimeout, or least recently used first when the store is
+// full. They are saved after every turn, so with a sessions dir an evicted session is
+// loaded again by its next request.
+type sessionStore struct {
+	mu           sync.Mutex
+	sessions     map[string]*session
+	memoryTokens int
+	// dir is where sessions are persisted, empty keeps them in memory only.
+	dir string
+}
+
+func newSessionStore(memoryTokens int, dir string) *sessionStore {
+	return &sessionStore{
+		sessions:     make(map[string]*session),
+		memoryTokens: memoryTokens,
+		dir:          dir,
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate session id")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (s *sessionStore) create() (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	mem, err := memory.New(s.memoryTokens)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.makeRoom(time.Now()) {
+		return "", errTooManySessions
+	}
+
+	s.sessions[id] = &session{mem: mem, lastUsed: time.Now()}
+
+	return id, nil
+}
+
+// get returns the session with id, loading it from disk when it was saved by an earlier run
+// or evicted. Every session get returns must be given back with release.
+func (s *sessionStore) get(id string) (*session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if sess, ok := s.sessions[id]; ok {
+		sess.refs++
+		sess.lastUsed = now
+
+		return sess, true, nil
+	}
+
+	if s.dir == "" {
+		return nil, false, nil
+	}
+
+	path, err := memory.SessionPath(s.dir, id)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	mem, err := memory.New(s.memoryTokens)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := mem.Load(path); err != nil {
+		return nil, false, err
+	}
+
+	if len(mem.Turns) == 0 && mem.Summary == "" {
+		return nil, false, nil
+	}
+
+	if !s.makeRoom(now) {
+		return nil, false, errTooManySessions
+	}
+
+	sess := &session{mem: mem, lastUsed: now, refs: 1}
+	s.sessions[id] = sess
+
+	return sess, true, nil
+}
+
+func (s *sessionStore) release(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess.refs--
+	sess.lastUsed = time.Now()
+}
+
+// makeRoom evicts the idle sessions and, when the store is still full, the least recently
+// used one. It reports false when every session is in use. s.mu must be held.
+func (s *sessionStore) makeRoom(now time.Time) bool {
+	var lruID string
+	var lru *session
+	for id, sess := range s.sessions {
+		if sess.refs > 0 {
+			continue
+		}
+
+		if now.Sub(sess.lastUsed) > SessionIdleTimeout {
+			delete(s.sessions, id)
+			continue
+		}
+
+		if lru == nil || sess.lastUsed.Before(lru.lastUsed) {
+			lruID, lru = id, sess
+		}
+	}
+
+	if len(s.sessions) < MaxSessions {
+		return true
+	}
+
+	if lru == nil {
+		return false
+	}
+
+	delete(s.sessions, lruID)
+
+	return true
+}
+
+func (s *sessionStore) save(id string, sess *session) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	path, err := memory.SessionPath(s.dir, id)
+	if err != nil {
+		return err
+	}
+
+	return sess.mem.Save(path)
+}
@@ -81,3 +81,24 @@ func InvokeMatchFunction(
 
 	return results, nil
 }
+
+// ReadEmbeddingDimensions returns the declared size of the table's embedding column, 0 when it has none.
+func ReadEmbeddingDimensions(
+	dbClient *supa.Client,
+	tableName string,
+) (int, error) {
+	var dimensions *int
+
+	err := dbClient.DB.Rpc(constants.EmbeddingDimensionsFunctionName, map[string]any{
+		"table_name": tableName,
+	}).Execute(&dimensions)
+	if err != nil {
+		return 0, err
+	}
+
+	if dimensions == nil {
+		return 0, nil
+	}
+
+	return *dimensions, nil
+}
@@ -0,0 +1,82 @@
+package catalogue
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pop-choice/models"
+
+	"github.com/pkg/errors"
+)
+
+// Problem is a row of a source that could not be imported.
+type Problem struct {
+	Row int
+	Err error
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("row %d: %v", p.Row, p.Err)
+}
+
+// Load reads movies from a CSV, TSV, JSON or JSON Lines file, picked by its extension.
+// Rows that miss a required field are reported as problems instead of failing the import.
+func Load(path string) ([]models.Movie, []Problem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open catalogue")
+	}
+	defer f.Close()
+
+	var records []record
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err = readCSV(f)
+	case ".tsv":
+		records, err = readTSV(f)
+	case ".json":
+		records, err = readJSON(f)
+	case ".jsonl", ".ndjson":
+		records, err = readJSONLines(f)
+	default:
+		return nil, nil, errors.Errorf("unsupported catalogue format %q, use .csv, .tsv, .json or .jsonl", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read catalogue %s", path)
+	}
+
+	movies := make([]models.Movie, 0, len(records))
+	problems := make([]Problem, 0)
+	seen := make(map[string]int)
+
+	for i, r := range records {
+		m, err := r.movie()
+		if errors.Is(err, errNotAMovie) {
+			continue
+		}
+		if err != nil {
+			problems = append(problems, Problem{Row: i + 1, Err: err})
+			continue
+		}
+
+		// The last entry of a movie listed twice wins.
+		if j, ok := seen[Key(m)]; ok {
+			log.Printf("Row %d: %q (%s) is listed more than once, using the last entry\n", i+1, m.Title, m.ReleaseYear)
+			movies[j] = m
+			continue
+		}
+
+		seen[Key(m)] = len(movies)
+		movies = append(movies, m)
+	}
+
+	return movies, problems, nil
+}
+
+// Key identifies a movie across imports, so that edited entries replace their old version.
+func Key(m models.Movie) string {
+	return strings.ToLower(strings.TrimSpace(m.Title)) + "|" + strings.TrimSpace(m.ReleaseYear)
+}
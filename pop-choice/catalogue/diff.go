@@ -0,0 +1,44 @@
+package catalogue
+
+import (
+	"pop-choice/models"
+	"pop-choice/models/db"
+)
+
+// Change is an imported movie whose content differs from its stored row.
+type Change struct {
+	ID    int
+	Movie models.Movie
+}
+
+// Diff splits movies into new ones, changed ones and the number of unchanged ones,
+// so that only new and changed movies are embedded.
+func Diff(
+	movies []models.Movie,
+	existing []db.Document,
+) ([]models.Movie, []Change, int) {
+	stored := make(map[string]db.Document, len(existing))
+	for _, d := range existing {
+		if m, ok := models.ParseMovie(d.Content); ok {
+			stored[Key(m)] = d
+		}
+	}
+
+	added := make([]models.Movie, 0)
+	changed := make([]Change, 0)
+	unchanged := 0
+
+	for _, m := range movies {
+		d, ok := stored[Key(m)]
+		switch {
+		case !ok:
+			added = append(added, m)
+		case d.Content != m.ToString():
+			changed = append(changed, Change{ID: d.ID, Movie: m})
+		default:
+			unchanged++
+		}
+	}
+
+	return added, changed, unchanged
+}
@@ -0,0 +1,174 @@
+package catalogue
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	records := make([]record, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make(map[string]string, len(header))
+		for i, h := range header {
+			if i < len(row) {
+				fields[h] = row[i]
+			}
+		}
+
+		records = append(records, newRecord(fields))
+	}
+}
+
+// readTSV reads tab separated files like the IMDb datasets, which never quote their fields.
+func readTSV(r io.Reader) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to read header")
+		}
+		return nil, errors.New("failed to read header: file is empty")
+	}
+	header := strings.Split(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\t")
+
+	records := make([]record, 0)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		row := strings.Split(scanner.Text(), "\t")
+
+		fields := make(map[string]string, len(header))
+		for i, h := range header {
+			if i < len(row) {
+				fields[h] = row[i]
+			}
+		}
+
+		records = append(records, newRecord(fields))
+	}
+
+	return records, scanner.Err()
+}
+
+// readJSON reads an array of movies, or an object holding them in "results" or "movies" like TMDB's API does.
+func readJSON(r io.Reader) ([]record, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]any
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &wrapper); err != nil {
+			return nil, errors.New("expected an array of movies or an object with a \"results\" or \"movies\" array")
+		}
+
+		list, ok := wrapper["results"]
+		if !ok {
+			list, ok = wrapper["movies"]
+		}
+		if !ok {
+			return nil, errors.New("expected an array of movies or an object with a \"results\" or \"movies\" array")
+		}
+
+		if err := json.Unmarshal(list, &objects); err != nil {
+			return nil, err
+		}
+	}
+
+	records := make([]record, len(objects))
+	for i, o := range objects {
+		records[i] = flatten(o)
+	}
+
+	return records, nil
+}
+
+func readJSONLines(r io.Reader) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	records := make([]record, 0)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var o map[string]any
+		if err := json.Unmarshal([]byte(text), &o); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		records = append(records, flatten(o))
+	}
+
+	return records, scanner.Err()
+}
+
+// flatten turns JSON values into strings: numbers as written, lists joined with "|",
+// and objects such as TMDB's {"id": 28, "name": "Action"} by their name.
+func flatten(o map[string]any) record {
+	fields := make(map[string]string, len(o))
+	for k, v := range o {
+		fields[k] = flattenValue(v)
+	}
+
+	return newRecord(fields)
+}
+
+func flattenValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return fmt.Sprint(t)
+	case bool:
+		return fmt.Sprint(t)
+	case []any:
+		values := make([]string, 0, len(t))
+		for _, item := range t {
+			if s := flattenValue(item); s != "" {
+				values = append(values, s)
+			}
+		}
+		return strings.Join(values, "|")
+	case map[string]any:
+		if name, ok := t["name"].(string); ok {
+			return name
+		}
+		return ""
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,199 @@
+package catalogue
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pop-choice/models"
+
+	"github.com/pkg/errors"
+)
+
+// Field aliases of the supported layouts: our own, TMDB exports (e.g. tmdb_5000_movies.csv or the
+// API's "results"), IMDb datasets (title.basics.tsv joined with title.ratings.tsv) and the
+// IMDb top 1000 export. Keys are compared lower case with "_", "-" and " " removed.
+var (
+	titleFields    = []string{"title", "primarytitle", "originaltitle", "seriestitle", "name"}
+	yearFields     = []string{"releaseyear", "year", "startyear", "releasedyear"}
+	dateFields     = []string{"releasedate", "firstairdate", "released"}
+	runtimeFields  = []string{"runtime", "runtimeminutes", "duration"}
+	overviewFields = []string{"overview", "plot", "description", "synopsis", "tagline"}
+	genreFields    = []string{"genres", "genre"}
+	directorFields = []string{"director", "directors"}
+	castFields     = []string{"cast", "stars", "actors", "star1", "star2", "star3", "star4"}
+	imdbFields     = []string{"averagerating", "imdbrating"}
+	tmdbFields     = []string{"voteaverage"}
+	contentFields  = []string{"content"}
+)
+
+var (
+	yearPattern    = regexp.MustCompile(`\b(18|19|20)\d{2}\b`)
+	minutesPattern = regexp.MustCompile(`^(\d+)\s*(?:m|min|mins|minutes)?$`)
+	keyReplacer    = strings.NewReplacer("_", "", "-", "", " ", "")
+)
+
+// errNotAMovie marks rows of series, episodes and the like in IMDb datasets, they are skipped silently.
+var errNotAMovie = errors.New("not a movie")
+
+// record is a single row of a source with normalized keys.
+type record map[string]string
+
+func newRecord(fields map[string]string) record {
+	r := make(record, len(fields))
+	for k, v := range fields {
+		v = strings.TrimSpace(v)
+		// IMDb datasets use \N for missing values.
+		if v == `\N` {
+			v = ""
+		}
+
+		// TMDB's CSV exports hold lists as JSON, e.g. [{"id": 28, "name": "Action"}].
+		if strings.HasPrefix(v, "[{") {
+			var list []any
+			if err := json.Unmarshal([]byte(v), &list); err == nil {
+				v = flattenValue(list)
+			}
+		}
+
+		r[keyReplacer.Replace(strings.ToLower(strings.TrimSpace(k)))] = v
+	}
+
+	return r
+}
+
+func (r record) first(keys []string) string {
+	for _, k := range keys {
+		if v := r[k]; v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (r record) all(keys []string) []string {
+	values := make([]string, 0)
+	for _, k := range keys {
+		if v := r[k]; v != "" {
+			values = append(values, splitList(v)...)
+		}
+	}
+
+	return values
+}
+
+// splitList splits lists such as "Action|Drama" or "Action, Drama".
+func splitList(v string) []string {
+	sep := ","
+	if strings.Contains(v, "|") {
+		sep = "|"
+	}
+
+	values := make([]string, 0)
+	for _, s := range strings.Split(v, sep) {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+}
+
+func formatRuntime(minutes int) string {
+	switch {
+	case minutes < 60:
+		return fmt.Sprintf("%d min", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d hr", minutes/60)
+	default:
+		return fmt.Sprintf("%d hr %d min", minutes/60, minutes%60)
+	}
+}
+
+// movie maps a record into a movie. When the source has no content column, the content is
+// written in the same shape as the built-in movies, so that runtimes can be read back from it.
+// Only the title and the release year are required.
+func (r record) movie() (models.Movie, error) {
+	if titleType := strings.ToLower(r["titletype"]); titleType != "" && titleType != "movie" && titleType != "tvmovie" {
+		return models.Movie{}, errNotAMovie
+	}
+
+	title := r.first(titleFields)
+	if title == "" {
+		return models.Movie{}, errors.New("missing title")
+	}
+
+	year := r.first(yearFields)
+	if year == "" {
+		year = yearPattern.FindString(r.first(dateFields))
+	}
+	if !yearPattern.MatchString(year) {
+		return models.Movie{}, errors.Errorf("missing or invalid release year %q for %q", year, title)
+	}
+	year = yearPattern.FindString(year)
+
+	if content := r.first(contentFields); content != "" {
+		return models.Movie{Title: title, ReleaseYear: year, Content: content}, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(title)
+
+	if m := minutesPattern.FindStringSubmatch(strings.ToLower(r.first(runtimeFields))); m != nil {
+		if minutes, _ := strconv.Atoi(m[1]); minutes > 0 {
+			sb.WriteString(" (" + formatRuntime(minutes) + ")")
+		}
+	}
+
+	sb.WriteString(":")
+
+	// IMDb's title.basics has no plot, those movies are described by their other columns alone.
+	if overview := r.first(overviewFields); overview != "" {
+		sb.WriteString(" " + strings.TrimSuffix(overview, ".") + ".")
+	}
+
+	if genres := r.all(genreFields); len(genres) > 0 {
+		sb.WriteString(" " + strings.Join(genres, ", ") + " film released in " + year + ".")
+	} else {
+		sb.WriteString(" Film released in " + year + ".")
+	}
+
+	if directors := r.all(directorFields); len(directors) > 0 {
+		sb.WriteString(" Directed by " + joinNames(directors) + ".")
+	}
+
+	if cast := r.all(castFields); len(cast) > 0 {
+		if len(cast) > 3 {
+			cast = cast[:3]
+		}
+		sb.WriteString(" Starring " + joinNames(cast) + ".")
+	}
+
+	if rating := r.first(imdbFields); rating != "" {
+		sb.WriteString(" Rated " + rating + " on IMDB")
+	} else if rating := r.first(tmdbFields); rating != "" {
+		sb.WriteString(" Rated " + rating + " on TMDB")
+	} else if rating := r["rating"]; rating != "" {
+		sb.WriteString(" Rated " + rating)
+	}
+
+	return models.Movie{
+		Title:       title,
+		ReleaseYear: year,
+		Content:     strings.TrimSpace(sb.String()),
+	}, nil
+}
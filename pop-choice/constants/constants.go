@@ -50,17 +50,6 @@ var Movies = []models.Movie{
 	},
 }
 
-var InitialListOfQuestions = []string{
-	"What is your favorite movie and why?",
-	"Are you in a mood for somethig new or a classic?",
-	"Do you wanna have fun or do you want something serious?",
-}
-
-var ExtraListOfQuestionsForMultiUser = []string{
-	"How many folks are watching?",
-	"What is the preferred duration?",
-}
-
 const (
 	PopChoiceSystemMessage = `You are an enthusiastic movie expert who loves recommending movies to people. Some context about movies, and a list of user interests to gauge user's choice. Your main job is to formulate a short answer to the question using the provided context. If you are unsure and cannot find the answer, say, "Unable to recommend movies based on choices." Please do not make up the answer.`
 	MultiUserFilterTmpl    = `Recommend movie to be watched by a group of %s people who would like to watch for a duration of %s. You are an enthusiastic movie expert who loves recommending movies to people. You will be given some context about a movie, and a list of user interests to gauge user's choice for each user. Your main job is to formulate a short answer to the question using the provided context. If you are unsure and cannot find the answer, say, "Unable to recommend movies based on choices." Please do not make up the answer.`
@@ -69,9 +58,23 @@ const (
 	FrequencyPenalty       = 0.0
 )
 
+// Retrieval
+const (
+	// CandidatePool is the least number of movies matched before they are filtered, and scored for a whole group.
+	CandidatePool = 10
+)
+
 // Supabase
 const (
 	PopChoiceTblName              = "pop_choice"
 	PopChoiceFunctionName         = "match_pop_choice"
 	PopChoiceTblContentColumnName = "content"
+	PopChoiceTblIDColumnName      = "id"
+	PopChoiceTblColumnNames       = "id,content,embedding"
+	PopChoiceTblKeyColumnNames    = "id,content"
+	ReadPageSize                  = 1000
+	// EmbeddingBatchSize is the number of movies embedded and inserted per request during setup.
+	EmbeddingBatchSize = 100
+
+	EmbeddingDimensionsFunctionName = "embedding_dimensions"
 )
@@ -0,0 +1,55 @@
+// Package duration reads the durations users answer with, e.g. the time they have for a movie.
+package duration
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hoursPattern   = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:h|hr|hrs|hour|hours)\b`)
+	minutesPattern = regexp.MustCompile(`(\d+)\s*(?:m|min|mins|minute|minutes)\b`)
+	numberPattern  = regexp.MustCompile(`^\D*(\d+(?:\.\d+)?)\D*$`)
+)
+
+// Parse returns the minutes of a duration such as "2 hours", "1h 30m", "90 min" or "2.5".
+// A bare number up to 10 is taken as hours and anything larger as minutes.
+// It returns false when the answer holds no duration, e.g. "doesn't matter".
+func Parse(answer string) (int, bool) {
+	answer = strings.ToLower(answer)
+
+	minutes := 0.0
+	found := false
+
+	if m := hoursPattern.FindStringSubmatch(answer); m != nil {
+		hours, _ := strconv.ParseFloat(m[1], 64)
+		minutes += hours * 60
+		found = true
+	}
+
+	if m := minutesPattern.FindStringSubmatch(answer); m != nil {
+		mins, _ := strconv.ParseFloat(m[1], 64)
+		minutes += mins
+		found = true
+	}
+
+	if !found {
+		m := numberPattern.FindStringSubmatch(answer)
+		if m == nil {
+			return 0, false
+		}
+
+		n, _ := strconv.ParseFloat(m[1], 64)
+		if n <= 10 {
+			n *= 60
+		}
+		minutes = n
+	}
+
+	if minutes <= 0 {
+		return 0, false
+	}
+
+	return int(minutes), true
+}
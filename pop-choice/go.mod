@@ -3,17 +3,27 @@ module pop-choice
 go 1.24.1
 
 require (
+	embedder v0.0.0
+	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/nedpals/supabase-go v0.5.0
 	github.com/openai/openai-go v0.1.0-beta.10
+	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible // indirect
+	embedcache v0.0.0 // indirect
 	github.com/go-viper/mapstructure/v2 v2.2.1 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
+	go.etcd.io/bbolt v1.4.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
+
+replace (
+	embedcache => ../embedcache
+	embedder => ../embedder
 )
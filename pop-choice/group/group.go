@@ -0,0 +1,83 @@
+package group
+
+import (
+	"math"
+	"sort"
+
+	"pop-choice/models"
+)
+
+type Member struct {
+	Name    string
+	Answers []string
+	// Input is the text embedded for the member.
+	Input     string
+	Embedding []float64
+}
+
+type Candidate struct {
+	ID        int
+	Content   string
+	Movie     models.Movie
+	Embedding []float64
+	// Scores holds the similarity to each member, in the order of the members.
+	Scores     []float64
+	GroupScore float64
+}
+
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// FilterRuntime drops the candidates that run longer than maxMinutes.
+// Candidates without a known runtime are kept, as they can't be ruled out.
+func FilterRuntime(candidates []Candidate, maxMinutes int) []Candidate {
+	kept := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if runtime := c.Movie.RuntimeMinutes(); runtime > 0 && runtime > maxMinutes {
+			continue
+		}
+
+		kept = append(kept, c)
+	}
+
+	return kept
+}
+
+// Rank scores every candidate against every member and orders them by the strategy's group score.
+func Rank(
+	candidates []Candidate,
+	members []Member,
+	strategy Strategy,
+) []Candidate {
+	for i := range candidates {
+		scores := make([]float64, len(members))
+		for j, m := range members {
+			scores[j] = CosineSimilarity(candidates[i].Embedding, m.Embedding)
+		}
+
+		candidates[i].Scores = scores
+		candidates[i].GroupScore = strategy.Combine(scores)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].GroupScore > candidates[j].GroupScore
+	})
+
+	return candidates
+}
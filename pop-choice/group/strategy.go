@@ -0,0 +1,53 @@
+package group
+
+import (
+	"github.com/pkg/errors"
+)
+
+type Strategy string
+
+const (
+	// Average picks what the group likes most on the whole.
+	Average Strategy = "average"
+	// LeastMisery scores a movie by its least happy member, so nobody has to sit through something they dislike.
+	LeastMisery Strategy = "least-misery"
+	// MostPleasure scores a movie by its happiest member.
+	MostPleasure Strategy = "most-pleasure"
+)
+
+var Strategies = []Strategy{Average, LeastMisery, MostPleasure}
+
+func ParseStrategy(s string) (Strategy, error) {
+	for _, strategy := range Strategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+
+	return "", errors.Errorf("unknown strategy %q, allowed values: average, least-misery, most-pleasure", s)
+}
+
+// Combine folds the per member scores of a movie into a single group score.
+func (s Strategy) Combine(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	combined := scores[0]
+	for _, score := range scores[1:] {
+		switch s {
+		case LeastMisery:
+			combined = min(combined, score)
+		case MostPleasure:
+			combined = max(combined, score)
+		default:
+			combined += score
+		}
+	}
+
+	if s != LeastMisery && s != MostPleasure {
+		combined /= float64(len(scores))
+	}
+
+	return combined
+}
@@ -6,21 +6,32 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"pop-choice/catalogue"
 	"pop-choice/constants"
+	"pop-choice/group"
 	"pop-choice/models"
+	"pop-choice/models/db"
 	openaipkg "pop-choice/openai"
+	"pop-choice/profile"
+	"pop-choice/questionnaire"
+	"pop-choice/recommend"
 	"pop-choice/supabase"
 
+	"embedder"
+
 	"github.com/caarlos0/env"
 	supa "github.com/nedpals/supabase-go"
 	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/packages/param"
 	"github.com/pkg/errors"
 )
 
@@ -43,8 +54,50 @@ func main() {
 		"action",
 		"",
 		"Allowed values: setup.")
+	formatFlag := flag.String(
+		"format",
+		"text",
+		"Output format of the recommendations. Allowed values: text, json.")
+	strategyFlag := flag.String(
+		"strategy",
+		string(group.Average),
+		"How the tastes of a group are combined in multi-user mode. Allowed values: average, least-misery, most-pleasure.")
+	questionnaireFlag := flag.String(
+		"questionnaire",
+		"",
+		"Path to a YAML questionnaire. Uses the built-in movie night questionnaire when empty.")
+	sourceFlag := flag.String(
+		"source",
+		"",
+		"Path to a CSV, TSV, JSON or JSON Lines catalogue imported by setup. Uses the built-in movies when empty.")
+	profileFlag := flag.String(
+		"profile",
+		"",
+		"Name of the user profile that stores ratings and personalises single-user recommendations.")
+	profilesDirFlag := flag.String(
+		"profiles-dir",
+		"profiles",
+		"Directory where user profiles are stored.")
 	flag.Parse()
 
+	format := "text"
+	if formatFlag != nil {
+		format = *formatFlag
+	}
+
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid format %q, allowed values: text, json\n", format)
+	}
+
+	strategy := group.Average
+	if strategyFlag != nil {
+		var err error
+		strategy, err = group.ParseStrategy(*strategyFlag)
+		if err != nil {
+			log.Fatalln("invalid strategy", err)
+		}
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
@@ -59,185 +112,199 @@ func main() {
 	supabaseClient := supabase.NewClient(envs.SupabaseProjectUrl, envs.SupabaseApiKey)
 	scanner := bufio.NewScanner(os.Stdin)
 
-	questionsTracker := 0
-	multiUserQuestionsTracker := 0
-	answersTracker := make([]string, len(constants.InitialListOfQuestions))
-	allAnswersTracker := make([]string, 0)
-	multiUserAnswersTracker := make([]string, len(constants.ExtraListOfQuestionsForMultiUser))
-	reRun := false
-	numOfUsersTracker := 1
+	emb, logCacheStats, err := embedder.FromEnv(envs.OpenApiKey, log.Printf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logCacheStats()
+
+	readDimensions := func(table string) (int, error) {
+		return supabase.ReadEmbeddingDimensions(supabaseClient, table)
+	}
+	if err := embedder.CheckTable(ctx, emb, constants.PopChoiceTblName, readDimensions, log.Printf); err != nil {
+		log.Fatalln(err)
+	}
 
 	action := ""
 	if actionFlag != nil {
 		action = *actionFlag
 	}
 
+	survey, err := questionnaire.Default()
+	if questionnaireFlag != nil && *questionnaireFlag != "" {
+		survey, err = questionnaire.Load(*questionnaireFlag)
+	}
+	if err != nil {
+		log.Fatalln("failed to load questionnaire", err)
+	}
+
+	var prof *profile.Profile
+	if profileFlag != nil && *profileFlag != "" {
+		profilesDir := "profiles"
+		if profilesDirFlag != nil {
+			profilesDir = *profilesDirFlag
+		}
+
+		prof, err = profile.Load(profilesDir, *profileFlag)
+		if err != nil {
+			log.Fatalln("failed to load profile", err)
+		}
+
+		if len(prof.Ratings) > 0 {
+			log.Printf("Loaded profile %q with %d ratings.\n", prof.Name, len(prof.Ratings))
+		}
+	}
+
+	ask := func(prompt string) (string, bool) {
+		return readInput(ctx, scanner, prompt)
+	}
+	complain := func(msg string) {
+		log.Printf("Invalid answer: %s\n", msg)
+	}
+
 	switch action {
 	case "setup":
-		setup(ctx, openaiClient, supabaseClient)
+		source := ""
+		if sourceFlag != nil {
+			source = *sourceFlag
+		}
+
+		setup(ctx, supabaseClient, emb, source)
 	case "single-user":
 		log.Println("Pop choice started. Press Ctrl+C to exit.")
 
 		for {
-			select {
-			case <-ctx.Done():
-				if err := scanner.Err(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-				}
-
+			answers, err := questionnaire.Run(survey.Questions, ask, complain, "")
+			if errors.Is(err, questionnaire.ErrCancelled) {
 				log.Println("Pop choice ended. Hope you had a good time.")
-
 				return
-			default:
-				if reRun {
-					fmt.Print("> Do you wish to continue? yes/no: ")
-
-					if reRunCheck(ctx, scanner) {
-						questionsTracker = 0
-					} else {
-						return
-					}
-				}
+			}
+			if err != nil {
+				log.Fatalln("failed to run questionnaire", err)
+			}
 
-				if questionsTracker < len(constants.InitialListOfQuestions) {
-					fmt.Printf("> %s: ", constants.InitialListOfQuestions[questionsTracker])
-					questionsTracker++
-				}
+			maxRuntime, _ := answers.MaxRuntime()
 
-				inputCh := make(chan string)
-				errCh := make(chan error)
-				go func() {
-					if scanner.Scan() {
-						inputCh <- scanner.Text()
-					} else {
-						if err := scanner.Err(); err != nil {
-							errCh <- err
-						} else {
-							errCh <- fmt.Errorf("input closed")
-						}
-					}
-				}()
-
-				select {
-				case <-ctx.Done():
-					log.Println("Received shutdown signal during input. Exiting...")
-					return
-				case err := <-errCh:
-					log.Fatalf("failed to read input: %v", err)
-					return
-				case input := <-inputCh:
-					input = strings.TrimSpace(input)
-
-					if len(input) == 0 {
-						log.Println("You didn't enter anything. Try again!")
-						continue
-					}
-
-					answersTracker[questionsTracker-1] = input
-
-					if questionsTracker == len(constants.InitialListOfQuestions) {
-						fmt.Println(generateResponse(
-							ctx,
-							openaiClient,
-							supabaseClient,
-							answersTracker,
-							1,
-							constants.PopChoiceSystemMessage))
-						reRun = true
-					}
-				}
+			recommendations := generateResponse(
+				ctx,
+				openaiClient,
+				supabaseClient,
+				emb,
+				answers,
+				maxRuntime,
+				prof,
+				1,
+				constants.PopChoiceSystemMessage)
+
+			writeRecommendations(recommendations, format)
+
+			if prof != nil {
+				rateRecommendations(ctx, scanner, prof, recommendations)
+			}
+
+			fmt.Print("> Do you wish to continue? yes/no: ")
+			if !reRunCheck(ctx, scanner) {
+				return
 			}
 		}
 	case "multi-user":
 		log.Println("Pop choice started. Press Ctrl+C to exit.")
-		for {
-			select {
-			case <-ctx.Done():
-				if err := scanner.Err(); err != nil {
-					fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-				}
 
-				log.Println("Pop choice ended. Hope you had a good time.")
+		groupAnswers, err := questionnaire.Run(survey.Group, ask, complain, "")
+		if errors.Is(err, questionnaire.ErrCancelled) {
+			log.Println("Pop choice ended. Hope you had a good time.")
+			return
+		}
+		if err != nil {
+			log.Fatalln("failed to run questionnaire", err)
+		}
 
+		numOfUsers, ok := groupAnswers.GroupSize()
+		if !ok {
+			log.Fatalf("questionnaire %q has no %s question in its group section\n", survey.Name, questionnaire.GroupSize)
+		}
+
+		maxRuntime, _ := groupAnswers.MaxRuntime()
+		duration := "any length of time"
+		if answer, ok := groupAnswers.ByRole(questionnaire.MaxRuntime); ok && answer.Text != "" {
+			duration = answer.Text
+		}
+
+		members := make([]group.Member, 0, numOfUsers)
+		for i := 1; i <= numOfUsers; i++ {
+			name := fmt.Sprintf("User-%d", i)
+
+			answers, err := questionnaire.Run(survey.Questions, ask, complain, name+", ")
+			if errors.Is(err, questionnaire.ErrCancelled) {
+				log.Println("Pop choice ended. Hope you had a good time.")
 				return
-			default:
-				if multiUserQuestionsTracker < len(constants.ExtraListOfQuestionsForMultiUser) {
-					fmt.Printf("> %s: ", constants.ExtraListOfQuestionsForMultiUser[multiUserQuestionsTracker])
-					multiUserQuestionsTracker++
-				}
+			}
+			if err != nil {
+				log.Fatalln("failed to run questionnaire", err)
+			}
 
-				if multiUserQuestionsTracker > len(constants.ExtraListOfQuestionsForMultiUser) &&
-					questionsTracker < len(constants.InitialListOfQuestions) {
-					fmt.Printf("> %s, %s: ",
-						fmt.Sprintf("User-%d", numOfUsersTracker),
-						constants.InitialListOfQuestions[questionsTracker])
-					questionsTracker++
-				}
+			// The strictest limit wins when people are asked for their own time.
+			if memberMaxRuntime, ok := answers.MaxRuntime(); ok && (maxRuntime == 0 || memberMaxRuntime < maxRuntime) {
+				maxRuntime = memberMaxRuntime
+			}
 
-				inputCh := make(chan string)
-				errCh := make(chan error)
-				go func() {
-					if scanner.Scan() {
-						inputCh <- scanner.Text()
-					} else {
-						if err := scanner.Err(); err != nil {
-							errCh <- err
-						} else {
-							errCh <- fmt.Errorf("input closed")
-						}
-					}
-				}()
-
-				select {
-				case <-ctx.Done():
-					log.Println("Received shutdown signal during input. Exiting...")
-					return
-				case err := <-errCh:
-					log.Fatalf("failed to read input: %v", err)
-					return
-				case input := <-inputCh:
-					input = strings.TrimSpace(input)
-
-					if len(input) == 0 {
-						log.Println("You didn't enter anything. Try again!")
-						continue
-					}
-
-					if multiUserQuestionsTracker > 0 && questionsTracker == 0 {
-						multiUserAnswersTracker[multiUserQuestionsTracker-1] = input
-					}
-
-					if multiUserQuestionsTracker == len(constants.ExtraListOfQuestionsForMultiUser) {
-						multiUserQuestionsTracker++
-					}
-
-					if questionsTracker > 0 {
-						answersTracker[questionsTracker-1] = input
-					}
-
-					if multiUserQuestionsTracker >= len(constants.ExtraListOfQuestionsForMultiUser) &&
-						questionsTracker == len(constants.InitialListOfQuestions) {
-						numOfUsersTracker++
-
-						if numOfUsers, err := strconv.Atoi(multiUserAnswersTracker[0]); err != nil && numOfUsers == numOfUsersTracker {
-							fmt.Println(generateResponse(
-								ctx,
-								openaiClient,
-								supabaseClient,
-								allAnswersTracker,
-								3,
-								fmt.Sprintf(constants.MultiUserFilterTmpl, multiUserAnswersTracker[0], multiUserAnswersTracker[1])))
-							return
-						}
-
-						allAnswersTracker = append(allAnswersTracker, []string{"\n", fmt.Sprintf("User-%d's interests", numOfUsersTracker), "\n"}...)
-						allAnswersTracker = append(allAnswersTracker, answersTracker...)
-
-						answersTracker = make([]string, len(constants.InitialListOfQuestions))
-					}
-				}
+			members = append(members, group.Member{
+				Name:    name,
+				Answers: answers.Texts(),
+				Input:   answers.EmbeddingInput(),
+			})
+		}
+
+		recommendations := generateGroupResponse(
+			ctx,
+			openaiClient,
+			supabaseClient,
+			emb,
+			members,
+			maxRuntime,
+			strategy,
+			3,
+			fmt.Sprintf(constants.MultiUserFilterTmpl, strconv.Itoa(numOfUsers), duration))
+		if len(recommendations) == 0 {
+			log.Println("Unable to recommend movies based on choices.")
+			return
+		}
+
+		writeRecommendations(recommendations, format)
+	}
+}
+
+// readInput prompts for a line of input, it returns false when the input ends or is cancelled.
+func readInput(
+	ctx context.Context,
+	scanner *bufio.Scanner,
+	prompt string,
+) (string, bool) {
+	fmt.Printf("> %s: ", prompt)
+
+	inputCh := make(chan string)
+	errCh := make(chan error)
+	go func() {
+		if scanner.Scan() {
+			inputCh <- scanner.Text()
+		} else {
+			if err := scanner.Err(); err != nil {
+				errCh <- err
+			} else {
+				errCh <- fmt.Errorf("input closed")
 			}
 		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("Received shutdown signal during input. Exiting...")
+		return "", false
+	case err := <-errCh:
+		log.Fatalf("failed to read input: %v", err)
+		return "", false
+	case input := <-inputCh:
+		return input, true
 	}
 }
 
@@ -280,145 +347,377 @@ func generateResponse(
 	ctx context.Context,
 	openaiClient openai.Client,
 	supabaseClient *supa.Client,
-	answersTracker []string,
+	emb embedder.Embedder,
+	answers questionnaire.Answers,
+	maxRuntime int,
+	prof *profile.Profile,
 	numberOfresponses int,
 	systemPrompt string,
-) []string {
-	responses := make([]string, 0)
+) []models.Recommendation {
+	recommendations := make([]models.Recommendation, 0)
 
-	systemMessage := openai.ChatCompletionMessageParamUnion{
-		OfSystem: &openai.ChatCompletionSystemMessageParam{
-			Content: openai.ChatCompletionSystemMessageParamContentUnion{
-				OfString: openai.String(systemPrompt),
-			},
-		},
-	}
-
-	combinedInput := ""
-	for _, a := range answersTracker {
-		combinedInput += a + "\n"
-	}
+	combinedInput := answers.EmbeddingInput()
 
-	res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-		Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-		Input: openai.EmbeddingNewParamsInputUnion{
-			OfString: openai.String(combinedInput),
-		},
-	})
+	embeddings, err := emb.Embed(ctx, []string{combinedInput})
 	if err != nil {
 		log.Fatalln("failed to generate embeddings", err)
 	}
 
-	if res != nil && len(res.Data) > 0 {
-		matchedPopChoiceMovies, err := supabase.InvokeMatchFunction(supabaseClient, constants.PopChoiceFunctionName, res.Data[0].Embedding, numberOfresponses)
+	if len(embeddings) > 0 {
+		personalised := prof != nil && len(prof.Ratings) > 0
+
+		// Fetch more than needed when some of the matches may run too long or get re-ranked,
+		// and as many more as the user excluded, since those are only dropped after matching.
+		numMatches := numberOfresponses
+		if maxRuntime > 0 || personalised {
+			numMatches = max(numMatches, constants.CandidatePool)
+		}
+		if personalised {
+			numMatches += len(prof.Excluded())
+		}
+
+		matchedPopChoiceMovies, err := supabase.InvokeMatchFunction(supabaseClient, constants.PopChoiceFunctionName, embeddings[0], numMatches)
 		if err != nil {
 			log.Fatalln("failed to match pop choice movies for query", err)
 		}
 
+		catalogue := recommend.NewCatalogue(constants.Movies)
+
+		if personalised {
+			matchedPopChoiceMovies = rerank(supabaseClient, prof, embeddings[0], matchedPopChoiceMovies)
+		}
+
+		if maxRuntime > 0 {
+			kept := make([]db.MatchedDocument, 0, len(matchedPopChoiceMovies))
+			for _, m := range matchedPopChoiceMovies {
+				if runtime := catalogue.Movie(m.Content).RuntimeMinutes(); runtime == 0 || runtime <= maxRuntime {
+					kept = append(kept, m)
+				}
+			}
+			matchedPopChoiceMovies = kept
+		}
+
+		if len(matchedPopChoiceMovies) > numberOfresponses {
+			matchedPopChoiceMovies = matchedPopChoiceMovies[:numberOfresponses]
+		}
+
 		if len(matchedPopChoiceMovies) == 0 {
-			log.Fatalln("invalid number of matching pop choice movies found")
+			log.Println("Unable to recommend movies based on choices.")
+			return recommendations
 		}
 
 		for _, m := range matchedPopChoiceMovies {
-			userMessage := openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String(
-							fmt.Sprintf(
-								"Context: %s, User interests: %s",
-								m.Content, combinedInput),
-						),
-					},
-				},
+			recommendation, err := recommend.Recommend(ctx, openaiClient, catalogue, systemPrompt, m, answers.Texts())
+			if err != nil {
+				log.Fatalln("failed to recommend pop choice movie", err)
 			}
 
-			messages := []openai.ChatCompletionMessageParamUnion{systemMessage, userMessage}
+			recommendations = append(recommendations, recommendation)
+		}
+	}
 
-			chatResp, err := openaiClient.Chat.Completions.New(
-				ctx,
-				openai.ChatCompletionNewParams{
-					Messages:         messages,
-					Model:            openai.ChatModelGPT4,
-					Temperature:      param.NewOpt(constants.Temperature),
-					PresencePenalty:  param.NewOpt(constants.PresencePenalty),
-					FrequencyPenalty: param.NewOpt(constants.FrequencyPenalty),
-				})
+	return recommendations
+}
+
+// rerank drops the movies the user watched or disliked and orders the rest by their similarity
+// to the query shifted towards the user's liked movies and away from the disliked ones.
+func rerank(
+	supabaseClient *supa.Client,
+	prof *profile.Profile,
+	query []float64,
+	matches []db.MatchedDocument,
+) []db.MatchedDocument {
+	excluded := prof.Excluded()
+
+	ids := make([]int, 0, len(matches))
+	for _, m := range matches {
+		if !excluded[m.ID] {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	liked := readEmbeddings(supabaseClient, prof.MovieIDs(profile.Like))
+	disliked := readEmbeddings(supabaseClient, prof.MovieIDs(profile.Dislike))
+	candidates := readEmbeddings(supabaseClient, ids)
+
+	shifted := profile.Shift(query, slices.Collect(maps.Values(liked)), slices.Collect(maps.Values(disliked)))
+
+	reranked := make([]db.MatchedDocument, 0, len(ids))
+	for _, m := range matches {
+		embedding, ok := candidates[m.ID]
+		if excluded[m.ID] || !ok {
+			continue
+		}
+
+		m.Similarity = group.CosineSimilarity(shifted, embedding)
+		reranked = append(reranked, m)
+	}
+
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Similarity > reranked[j].Similarity
+	})
+
+	return reranked
+}
+
+func readEmbeddings(
+	supabaseClient *supa.Client,
+	ids []int,
+) map[int][]float64 {
+	embeddings := make(map[int][]float64, len(ids))
+	if len(ids) == 0 {
+		return embeddings
+	}
+
+	docs, err := supabase.ReadDocumentsByIDs(constants.PopChoiceTblName, supabaseClient, ids)
+	if err != nil {
+		log.Fatalln("failed to read pop choice movies", err)
+	}
+
+	for _, d := range docs {
+		embedding, err := d.Vector()
+		if err != nil {
+			log.Fatalln("failed to read pop choice movie embedding", err)
+		}
+
+		embeddings[d.ID] = embedding
+	}
+
+	return embeddings
+}
+
+// rateRecommendations asks the user to rate every recommendation and saves the ratings to the profile.
+func rateRecommendations(
+	ctx context.Context,
+	scanner *bufio.Scanner,
+	prof *profile.Profile,
+	recommendations []models.Recommendation,
+) {
+	for _, r := range recommendations {
+		for {
+			input, ok := readInput(ctx, scanner, fmt.Sprintf("Rate %q: like 👍 / dislike 👎 / watched, or press enter to skip", r.Title))
+			if !ok {
+				return
+			}
+
+			verdict, rated, err := profile.ParseVerdict(input)
 			if err != nil {
-				log.Fatalln("failed to generate pop choice movies response", err)
+				log.Printf("Invalid answer: %v\n", err)
+				continue
 			}
 
-			responses = append(responses, chatResp.Choices[0].Message.Content)
+			if rated {
+				prof.Rate(profile.Rating{
+					MovieID:     r.MovieID,
+					Title:       r.Title,
+					ReleaseYear: r.ReleaseYear,
+					Verdict:     verdict,
+					RatedAt:     time.Now(),
+				})
+			}
+
+			break
 		}
 	}
 
-	return responses
+	if err := prof.Save(); err != nil {
+		log.Fatalln("failed to save profile", err)
+	}
 }
 
-func setup(
+// generateGroupResponse embeds every member separately, scores the candidates each member
+// matched against all members and picks the best ones for the group by strategy.
+func generateGroupResponse(
 	ctx context.Context,
 	openaiClient openai.Client,
 	supabaseClient *supa.Client,
-) {
-	log.Println("Starting setup.....")
+	emb embedder.Embedder,
+	members []group.Member,
+	maxRuntime int,
+	strategy group.Strategy,
+	numberOfresponses int,
+	systemPrompt string,
+) []models.Recommendation {
+	inputs := make([]string, len(members))
+	for i, m := range members {
+		inputs[i] = m.Input
+	}
 
-	existingPopChoiceMovies := fetchExistingRows(supabaseClient, constants.PopChoiceTblName)
+	embeddings, err := emb.Embed(ctx, inputs)
+	if err != nil {
+		log.Fatalln("failed to generate embeddings", err)
+	}
 
-	log.Println("Fetched existing pop choice movies.....")
+	candidateIDs := make([]int, 0)
+	seen := make(map[int]bool)
+	for i, e := range embeddings {
+		members[i].Embedding = e
 
-	for _, m := range constants.Movies {
-		if _, ok := existingPopChoiceMovies[m.ToString()]; ok {
-			log.Printf("Skipping insert for: %s\n", m.ToString())
-			continue
+		matchedPopChoiceMovies, err := supabase.InvokeMatchFunction(supabaseClient, constants.PopChoiceFunctionName, e, max(constants.CandidatePool, numberOfresponses))
+		if err != nil {
+			log.Fatalln("failed to match pop choice movies for query", err)
+		}
+
+		for _, m := range matchedPopChoiceMovies {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				candidateIDs = append(candidateIDs, m.ID)
+			}
+		}
+	}
+
+	if len(candidateIDs) == 0 {
+		return nil
+	}
+
+	docs, err := supabase.ReadDocumentsByIDs(constants.PopChoiceTblName, supabaseClient, candidateIDs)
+	if err != nil {
+		log.Fatalln("failed to read pop choice movies", err)
+	}
+
+	catalogue := recommend.NewCatalogue(constants.Movies)
+
+	candidates := make([]group.Candidate, 0, len(docs))
+	for _, d := range docs {
+		embedding, err := d.Vector()
+		if err != nil {
+			log.Fatalln("failed to read pop choice movie embedding", err)
 		}
 
-		movieVector := getEmbeddings(ctx, openaiClient, []string{m.ToString()})
+		candidates = append(candidates, group.Candidate{
+			ID:        d.ID,
+			Content:   d.Content,
+			Movie:     catalogue.Movie(d.Content),
+			Embedding: embedding,
+		})
+	}
 
-		res, err := supabase.InsertDocument(constants.PopChoiceTblName, supabaseClient, movieVector[0])
+	if maxRuntime > 0 {
+		candidates = group.FilterRuntime(candidates, maxRuntime)
+	}
+
+	candidates = group.Rank(candidates, members, strategy)
+	if len(candidates) > numberOfresponses {
+		candidates = candidates[:numberOfresponses]
+	}
+
+	recommendations := make([]models.Recommendation, 0, len(candidates))
+	for _, c := range candidates {
+		recommendation, err := recommend.RecommendForGroup(ctx, openaiClient, systemPrompt, c, members)
 		if err != nil {
-			log.Fatalf("failed to insert embeddings for: '%s'\n: %v", movieVector[0].Content, err)
+			log.Fatalln("failed to recommend pop choice movie", err)
 		}
 
-		log.Printf("len of docs: %d\n", len(res))
+		recommendations = append(recommendations, recommendation)
+	}
+
+	return recommendations
+}
+
+func writeRecommendations(
+	recommendations []models.Recommendation,
+	format string,
+) {
+	var err error
+	switch format {
+	case "json":
+		err = recommend.WriteJSON(os.Stdout, recommendations)
+	default:
+		err = recommend.WriteText(os.Stdout, recommendations)
+	}
+	if err != nil {
+		log.Fatalln("failed to write recommendations", err)
 	}
 }
 
-func fetchExistingRows(
+func setup(
+	ctx context.Context,
 	supabaseClient *supa.Client,
-	tableName string) map[string]any {
-	allDocs, err := supabase.ReadDocuments(tableName, supabaseClient)
+	emb embedder.Embedder,
+	source string,
+) {
+	log.Println("Starting setup.....")
+
+	movies := constants.Movies
+	if source != "" {
+		imported, problems, err := catalogue.Load(source)
+		if err != nil {
+			log.Fatalln("failed to load catalogue", err)
+		}
+
+		for _, p := range problems {
+			log.Printf("Skipping %s\n", p)
+		}
+
+		if len(imported) == 0 {
+			log.Fatalf("no valid movies found in: '%s'\n", source)
+		}
+
+		log.Printf("Loaded %d movies from %s, skipped %d invalid rows.....\n", len(imported), source, len(problems))
+		movies = imported
+	}
+
+	existingPopChoiceMovies, err := supabase.ReadDocuments(constants.PopChoiceTblName, supabaseClient)
 	if err != nil {
-		log.Fatalf("failed to fetch embeddings from: '%s'\n: %v", tableName, err)
+		log.Fatalf("failed to fetch embeddings from: '%s'\n: %v", constants.PopChoiceTblName, err)
 	}
 
-	allDocsMap := make(map[string]any)
-	for _, d := range allDocs {
-		allDocsMap[d.Content] = nil
+	log.Println("Fetched existing pop choice movies.....")
+
+	added, changed, unchanged := catalogue.Diff(movies, existingPopChoiceMovies)
+
+	log.Printf("%d new, %d changed and %d unchanged movies.....\n", len(added), len(changed), unchanged)
+
+	for start := 0; start < len(added); start += constants.EmbeddingBatchSize {
+		batch := added[start:min(start+constants.EmbeddingBatchSize, len(added))]
+
+		contents := make([]string, len(batch))
+		for i, m := range batch {
+			contents[i] = m.ToString()
+		}
+
+		res, err := supabase.InsertDocuments(constants.PopChoiceTblName, supabaseClient, getEmbeddings(ctx, emb, contents))
+		if err != nil {
+			log.Fatalf("failed to insert embeddings for movies %d to %d\n: %v", start+1, start+len(batch), err)
+		}
+
+		log.Printf("Inserted %d of %d new movies\n", start+len(res), len(added))
 	}
 
-	return allDocsMap
+	for start := 0; start < len(changed); start += constants.EmbeddingBatchSize {
+		batch := changed[start:min(start+constants.EmbeddingBatchSize, len(changed))]
+
+		contents := make([]string, len(batch))
+		for i, c := range batch {
+			contents[i] = c.Movie.ToString()
+		}
+
+		for i, v := range getEmbeddings(ctx, emb, contents) {
+			if _, err := supabase.UpdateDocument(constants.PopChoiceTblName, supabaseClient, batch[i].ID, v); err != nil {
+				log.Fatalf("failed to update embeddings for: '%s'\n: %v", batch[i].Movie.Title, err)
+			}
+		}
+
+		log.Printf("Updated %d of %d changed movies\n", start+len(batch), len(changed))
+	}
 }
 
+// getEmbeddings embeds all sentences that are not cached yet in a single request.
 func getEmbeddings(
 	ctx context.Context,
-	openaiClient openai.Client,
+	emb embedder.Embedder,
 	sentences []string) []models.Vector {
-	vectors := make([]models.Vector, 0)
-
-	for _, s := range sentences {
-		res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-			Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: openai.String(s),
-			},
-		})
-		if err != nil {
-			log.Fatalln("failed to generate embeddings", err)
-		}
+	embeddings, err := emb.Embed(ctx, sentences)
+	if err != nil {
+		log.Fatalln("failed to generate embeddings", err)
+	}
 
-		vectors = append(vectors, models.Vector{
-			Content:   s,
-			Embedding: res.Data[0].Embedding,
-		})
+	vectors := make([]models.Vector, len(sentences))
+	for i, e := range embeddings {
+		vectors[i] = models.Vector{
+			Content:   sentences[i],
+			Embedding: e,
+		}
 	}
 
 	return vectors
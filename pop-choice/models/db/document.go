@@ -1,6 +1,23 @@
 package db
 
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
 type Document struct {
+	ID        int    `json:"id,omitempty"`
 	Content   string `json:"content"`
 	Embedding string `json:"embedding"`
 }
+
+// Vector parses the embedding, which pgvector returns in its text form, e.g. "[0.1,0.2]".
+func (d Document) Vector() ([]float64, error) {
+	var v []float64
+	if err := json.Unmarshal([]byte(d.Embedding), &v); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse embedding of document %d", d.ID)
+	}
+
+	return v, nil
+}
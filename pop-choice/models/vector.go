@@ -1,5 +1,14 @@
 package models
 
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// runtimePattern matches the runtime in a movie's content, e.g. "(2 hr 31 min)" or "(3 hr)".
+var runtimePattern = regexp.MustCompile(`\((?:(\d+)\s*hr)?\s*(?:(\d+)\s*min)?\)`)
+
 type Vector struct {
 	Content   string    `json:"content"`
 	Embedding []float64 `json:"embedding"`
@@ -14,3 +23,58 @@ type Movie struct {
 func (m Movie) ToString() string {
 	return "Title: " + m.Title + "\nRelease Year: " + m.ReleaseYear + "\nContent: " + m.Content
 }
+
+// RuntimeMinutes returns the runtime mentioned in the content, or 0 when there is none.
+func (m Movie) RuntimeMinutes() int {
+	for _, match := range runtimePattern.FindAllStringSubmatch(m.Content, -1) {
+		if match[1] == "" && match[2] == "" {
+			continue
+		}
+
+		hours, _ := strconv.Atoi(match[1])
+		minutes, _ := strconv.Atoi(match[2])
+
+		return hours*60 + minutes
+	}
+
+	return 0
+}
+
+// ParseMovie is the inverse of Movie.ToString.
+func ParseMovie(s string) (Movie, bool) {
+	title, rest, ok := strings.Cut(strings.TrimPrefix(s, "Title: "), "\nRelease Year: ")
+	if !ok || !strings.HasPrefix(s, "Title: ") {
+		return Movie{}, false
+	}
+
+	releaseYear, content, ok := strings.Cut(rest, "\nContent: ")
+	if !ok {
+		return Movie{}, false
+	}
+
+	return Movie{
+		Title:       title,
+		ReleaseYear: releaseYear,
+		Content:     content,
+	}, true
+}
+
+type Recommendation struct {
+	MovieID        int      `json:"movie_id,omitempty"`
+	Title          string   `json:"title"`
+	ReleaseYear    string   `json:"release_year"`
+	RuntimeMinutes int      `json:"runtime_minutes,omitempty"`
+	Reason         string   `json:"reason"`
+	MatchedAnswers []string `json:"matched_answers"`
+	// Similarity is the group score of the movie in group mode.
+	Similarity float64     `json:"similarity"`
+	Members    []MemberFit `json:"members,omitempty"`
+}
+
+// MemberFit explains how a group pick satisfies one member of the group.
+type MemberFit struct {
+	Name           string   `json:"name"`
+	Similarity     float64  `json:"similarity"`
+	Reason         string   `json:"reason"`
+	MatchedAnswers []string `json:"matched_answers"`
+}
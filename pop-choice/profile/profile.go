@@ -0,0 +1,135 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Verdict string
+
+const (
+	Like    Verdict = "like"
+	Dislike Verdict = "dislike"
+	Watched Verdict = "watched"
+)
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type Rating struct {
+	MovieID     int       `json:"movie_id"`
+	Title       string    `json:"title"`
+	ReleaseYear string    `json:"release_year"`
+	Verdict     Verdict   `json:"verdict"`
+	RatedAt     time.Time `json:"rated_at"`
+}
+
+// Profile holds the ratings of one user, they shift later recommendations towards what the user liked.
+type Profile struct {
+	Name    string   `json:"name"`
+	Ratings []Rating `json:"ratings"`
+
+	path string
+}
+
+// ParseVerdict reads a rating as typed by the user, an empty answer skips rating the movie.
+func ParseVerdict(input string) (Verdict, bool, error) {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "":
+		return "", false, nil
+	case "like", "l", "+", "y", "yes", "👍":
+		return Like, true, nil
+	case "dislike", "d", "-", "n", "no", "👎":
+		return Dislike, true, nil
+	case "watched", "w", "seen":
+		return Watched, true, nil
+	default:
+		return "", false, errors.Errorf("unknown rating %q, use like, dislike, watched or leave it empty to skip", input)
+	}
+}
+
+// Load reads the profile name from dir, a missing file is a new profile without ratings.
+func Load(dir, name string) (*Profile, error) {
+	if !validProfileName.MatchString(name) {
+		return nil, errors.Errorf("invalid profile name %q, use letters, digits, '-' and '_'", name)
+	}
+
+	p := &Profile{
+		Name:    name,
+		Ratings: make([]Rating, 0),
+		path:    filepath.Join(dir, name+".json"),
+	}
+
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read profile")
+	}
+
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, errors.Wrap(err, "failed to parse profile")
+	}
+
+	return p, nil
+}
+
+func (p *Profile) Save() error {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create profiles directory")
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode profile")
+	}
+
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write profile")
+	}
+
+	return os.Rename(tmp, p.path)
+}
+
+// Rate records a verdict, replacing an earlier rating of the same movie.
+func (p *Profile) Rate(rating Rating) {
+	for i, r := range p.Ratings {
+		if r.MovieID == rating.MovieID {
+			p.Ratings[i] = rating
+			return
+		}
+	}
+
+	p.Ratings = append(p.Ratings, rating)
+}
+
+// MovieIDs returns the IDs of the movies rated with verdict.
+func (p *Profile) MovieIDs(verdict Verdict) []int {
+	ids := make([]int, 0)
+	for _, r := range p.Ratings {
+		if r.Verdict == verdict {
+			ids = append(ids, r.MovieID)
+		}
+	}
+
+	return ids
+}
+
+// Excluded returns the movies that should not be recommended again: the watched and the disliked ones.
+func (p *Profile) Excluded() map[int]bool {
+	excluded := make(map[int]bool)
+	for _, r := range p.Ratings {
+		if r.Verdict == Watched || r.Verdict == Dislike {
+			excluded[r.MovieID] = true
+		}
+	}
+
+	return excluded
+}
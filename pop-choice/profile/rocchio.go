@@ -0,0 +1,40 @@
+package profile
+
+// Rocchio weights, the usual values from relevance feedback literature.
+// https://nlp.stanford.edu/IR-book/html/htmledition/the-rocchio71-algorithm-1.html
+const (
+	Alpha = 1.0
+	Beta  = 0.75
+	Gamma = 0.15
+)
+
+// Shift moves the query embedding towards the centroid of the liked movies
+// and away from the centroid of the disliked ones.
+func Shift(query []float64, liked, disliked [][]float64) []float64 {
+	shifted := make([]float64, len(query))
+	for i, v := range query {
+		shifted[i] = Alpha * v
+	}
+
+	addCentroid(shifted, liked, Beta)
+	addCentroid(shifted, disliked, -Gamma)
+
+	return shifted
+}
+
+func addCentroid(dst []float64, vectors [][]float64, weight float64) {
+	if len(vectors) == 0 {
+		return
+	}
+
+	scale := weight / float64(len(vectors))
+	for _, v := range vectors {
+		if len(v) != len(dst) {
+			continue
+		}
+
+		for i := range v {
+			dst[i] += scale * v[i]
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package questionnaire
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Answer struct {
+	QuestionID string
+	Question   string
+	Type       Type
+	Role       Role
+	Embed      bool
+	// Text is the answer as given, normalized to the option for choice questions.
+	Text string
+	// Number holds number answers, and duration answers in minutes.
+	Number float64
+	Bool   bool
+}
+
+// Answers holds the answers of one person, or of the group section, in the order they were given.
+type Answers struct {
+	order []string
+	byID  map[string]Answer
+}
+
+func NewAnswers() Answers {
+	return Answers{byID: make(map[string]Answer)}
+}
+
+func (a *Answers) Set(answer Answer) {
+	if _, ok := a.byID[answer.QuestionID]; !ok {
+		a.order = append(a.order, answer.QuestionID)
+	}
+
+	a.byID[answer.QuestionID] = answer
+}
+
+func (a Answers) Get(id string) (Answer, bool) {
+	answer, ok := a.byID[id]
+	return answer, ok
+}
+
+func (a Answers) All() []Answer {
+	all := make([]Answer, 0, len(a.order))
+	for _, id := range a.order {
+		all = append(all, a.byID[id])
+	}
+
+	return all
+}
+
+// ByRole returns the first answer to a question with role.
+func (a Answers) ByRole(role Role) (Answer, bool) {
+	for _, id := range a.order {
+		if a.byID[id].Role == role {
+			return a.byID[id], true
+		}
+	}
+
+	return Answer{}, false
+}
+
+// Texts returns the answers that describe the user's taste, they are what gets embedded.
+func (a Answers) Texts() []string {
+	texts := make([]string, 0, len(a.order))
+	for _, answer := range a.All() {
+		if answer.Embed && answer.Text != "" {
+			texts = append(texts, answer.Text)
+		}
+	}
+
+	return texts
+}
+
+// EmbeddingInput pairs every embedded answer with its question, so short answers like "new" keep their meaning.
+func (a Answers) EmbeddingInput() string {
+	var sb strings.Builder
+	for _, answer := range a.All() {
+		if answer.Embed && answer.Text != "" {
+			sb.WriteString(answer.Question + " " + answer.Text + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// MaxRuntime returns the runtime limit in minutes, if one of the questions asked for it.
+func (a Answers) MaxRuntime() (int, bool) {
+	answer, ok := a.ByRole(MaxRuntime)
+	if !ok || answer.Number <= 0 {
+		return 0, false
+	}
+
+	return int(answer.Number), true
+}
+
+// GroupSize returns the number of people in the group, if one of the questions asked for it.
+func (a Answers) GroupSize() (int, bool) {
+	answer, ok := a.ByRole(GroupSize)
+	if !ok || answer.Number < 1 {
+		return 0, false
+	}
+
+	return int(answer.Number), true
+}
+
+func (a Answer) String() string {
+	switch a.Type {
+	case YesNo:
+		if a.Bool {
+			return "yes"
+		}
+		return "no"
+	case Number:
+		return strconv.FormatFloat(a.Number, 'f', -1, 64)
+	default:
+		return a.Text
+	}
+}
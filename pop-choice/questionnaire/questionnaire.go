@@ -0,0 +1,195 @@
+package questionnaire
+
+import (
+	_ "embed"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type Type string
+
+const (
+	Text     Type = "text"
+	Choice   Type = "choice"
+	Number   Type = "number"
+	YesNo    Type = "yes_no"
+	Duration Type = "duration"
+)
+
+type Role string
+
+const (
+	// GroupSize answers how many people answer the per person questions in multi-user mode.
+	GroupSize Role = "group_size"
+	// MaxRuntime answers filter out movies that run longer.
+	MaxRuntime Role = "max_runtime"
+)
+
+// End ends the questionnaire when used as the target of a branch.
+const End = "end"
+
+//go:embed default.yaml
+var defaultQuestionnaire []byte
+
+type Question struct {
+	ID   string `yaml:"id"`
+	Text string `yaml:"text"`
+	Type Type   `yaml:"type"`
+	Role Role   `yaml:"role,omitempty"`
+	// Optional questions may be skipped with an empty answer.
+	Optional bool `yaml:"optional,omitempty"`
+	// Embed defaults to true for text and choice questions, their answers describe the user's taste.
+	Embed *bool `yaml:"embed,omitempty"`
+
+	Options   []string `yaml:"options,omitempty"`
+	Min       *float64 `yaml:"min,omitempty"`
+	Max       *float64 `yaml:"max,omitempty"`
+	MinLength int      `yaml:"min_length,omitempty"`
+	Pattern   string   `yaml:"pattern,omitempty"`
+
+	// Branches map an answer to the ID of the next question, e.g. {"yes": "which_one"}.
+	Branches map[string]string `yaml:"branches,omitempty"`
+	// Next is the ID of the question that follows when no branch matches, defaults to the next one in the list.
+	Next string `yaml:"next,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+func (q Question) Embedded() bool {
+	if q.Embed != nil {
+		return *q.Embed
+	}
+
+	return q.Type == Text || q.Type == Choice
+}
+
+type Questionnaire struct {
+	Name        string     `yaml:"name"`
+	Description string     `yaml:"description,omitempty"`
+	Group       []Question `yaml:"group,omitempty"`
+	Questions   []Question `yaml:"questions"`
+}
+
+// Default is the questionnaire used when none is given.
+func Default() (*Questionnaire, error) {
+	return Parse(defaultQuestionnaire)
+}
+
+func Load(path string) (*Questionnaire, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read questionnaire")
+	}
+
+	q, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid questionnaire %s", path)
+	}
+
+	return q, nil
+}
+
+func Parse(data []byte) (*Questionnaire, error) {
+	var q Questionnaire
+	if err := yaml.Unmarshal(data, &q); err != nil {
+		return nil, errors.Wrap(err, "failed to parse questionnaire")
+	}
+
+	if len(q.Questions) == 0 {
+		return nil, errors.New("questionnaire has no questions")
+	}
+
+	if err := validate(q.Group); err != nil {
+		return nil, errors.Wrap(err, "group")
+	}
+
+	if err := validate(q.Questions); err != nil {
+		return nil, errors.Wrap(err, "questions")
+	}
+
+	return &q, nil
+}
+
+// validate checks a section, branches may only point to questions of the same section.
+func validate(questions []Question) error {
+	ids := make(map[string]bool, len(questions))
+	for _, q := range questions {
+		if q.ID == "" || q.ID == End {
+			return errors.Errorf("question %q needs an id other than %q", q.Text, End)
+		}
+
+		if ids[q.ID] {
+			return errors.Errorf("duplicate question id %q", q.ID)
+		}
+
+		ids[q.ID] = true
+	}
+
+	for i := range questions {
+		q := &questions[i]
+
+		if q.Text == "" {
+			return errors.Errorf("question %q has no text", q.ID)
+		}
+
+		switch q.Type {
+		case Text, Number, YesNo, Duration:
+		case Choice:
+			if len(q.Options) < 2 {
+				return errors.Errorf("choice question %q needs at least two options", q.ID)
+			}
+		case "":
+			q.Type = Text
+		default:
+			return errors.Errorf("question %q has unknown type %q", q.ID, q.Type)
+		}
+
+		switch q.Role {
+		case "":
+		case GroupSize:
+			if q.Type != Number {
+				return errors.Errorf("group size question %q must be a number", q.ID)
+			}
+		case MaxRuntime:
+			if q.Type != Duration && q.Type != Number {
+				return errors.Errorf("max runtime question %q must be a duration or a number of minutes", q.ID)
+			}
+		default:
+			return errors.Errorf("question %q has unknown role %q", q.ID, q.Role)
+		}
+
+		if q.Pattern != "" {
+			pattern, err := regexp.Compile(q.Pattern)
+			if err != nil {
+				return errors.Wrapf(err, "question %q has an invalid pattern", q.ID)
+			}
+			q.pattern = pattern
+		}
+
+		// Answers pick their branch ignoring case, so two keys differing in case would make
+		// the choice depend on map order.
+		folded := make(map[string]string, len(q.Branches))
+		for _, answer := range slices.Sorted(maps.Keys(q.Branches)) {
+			if other, ok := folded[strings.ToLower(answer)]; ok {
+				return errors.Errorf("question %q branches on both %q and %q, branches ignore case", q.ID, other, answer)
+			}
+			folded[strings.ToLower(answer)] = answer
+
+			if target := q.Branches[answer]; target != End && !ids[target] {
+				return errors.Errorf("question %q branches on %q to unknown question %q", q.ID, answer, target)
+			}
+		}
+
+		if q.Next != "" && q.Next != End && !ids[q.Next] {
+			return errors.Errorf("question %q continues with unknown question %q", q.ID, q.Next)
+		}
+	}
+
+	return nil
+}
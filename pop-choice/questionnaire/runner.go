@@ -0,0 +1,196 @@
+package questionnaire
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pop-choice/duration"
+
+	"github.com/pkg/errors"
+)
+
+// maxStepsPerQuestion bounds branches that loop back, so a broken questionnaire can't ask forever.
+const maxStepsPerQuestion = 10
+
+var ErrCancelled = errors.New("questionnaire cancelled")
+
+// AskFunc shows a prompt and returns the user's input, false means the input ended or was cancelled.
+type AskFunc func(prompt string) (string, bool)
+
+// Run asks the questions in order, following branches, and re-asks until every answer is valid.
+// complain is told why an answer was rejected. prefix is put in front of every prompt, e.g. "User-1, ".
+func Run(
+	questions []Question,
+	ask AskFunc,
+	complain func(string),
+	prefix string,
+) (Answers, error) {
+	answers := NewAnswers()
+
+	index := make(map[string]int, len(questions))
+	for i, q := range questions {
+		index[q.ID] = i
+	}
+
+	i := 0
+	for steps := 0; i < len(questions); steps++ {
+		if steps > len(questions)*maxStepsPerQuestion {
+			return answers, errors.New("questionnaire does not end, check its branches")
+		}
+
+		q := questions[i]
+
+		var answer Answer
+		for {
+			input, ok := ask(prefix + prompt(q))
+			if !ok {
+				return answers, ErrCancelled
+			}
+
+			var err error
+			answer, err = parse(q, strings.TrimSpace(input))
+			if err == nil {
+				break
+			}
+
+			complain(err.Error())
+		}
+
+		answers.Set(answer)
+
+		next := q.Next
+		if target, ok := branch(q, answer); ok {
+			next = target
+		}
+
+		switch next {
+		case "":
+			i++
+		case End:
+			i = len(questions)
+		default:
+			i = index[next]
+		}
+	}
+
+	return answers, nil
+}
+
+func prompt(q Question) string {
+	switch q.Type {
+	case Choice:
+		return fmt.Sprintf("%s (%s)", q.Text, strings.Join(q.Options, "/"))
+	case YesNo:
+		return q.Text + " (yes/no)"
+	default:
+		return q.Text
+	}
+}
+
+func branch(q Question, answer Answer) (string, bool) {
+	for value, target := range q.Branches {
+		if strings.EqualFold(value, answer.String()) {
+			return target, true
+		}
+	}
+
+	return "", false
+}
+
+func parse(q Question, input string) (Answer, error) {
+	answer := Answer{
+		QuestionID: q.ID,
+		Question:   q.Text,
+		Type:       q.Type,
+		Role:       q.Role,
+		Embed:      q.Embedded(),
+		Text:       input,
+	}
+
+	if input == "" {
+		if q.Optional {
+			return answer, nil
+		}
+
+		return answer, errors.New("you didn't enter anything, try again")
+	}
+
+	switch q.Type {
+	case Choice:
+		option, ok := matchOption(q.Options, input)
+		if !ok {
+			return answer, errors.Errorf("please answer one of: %s", strings.Join(q.Options, ", "))
+		}
+		answer.Text = option
+	case Number:
+		n, err := strconv.ParseFloat(input, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return answer, errors.New("please enter a number, e.g. 3")
+		}
+		if q.Role == GroupSize && n != math.Trunc(n) {
+			return answer, errors.New("please enter a whole number of people, e.g. 3")
+		}
+		if err := checkRange(q, n); err != nil {
+			return answer, err
+		}
+		answer.Number = n
+	case Duration:
+		minutes, ok := duration.Parse(input)
+		if !ok {
+			return answer, errors.New("please enter a duration, e.g. 2 hours or 90 min")
+		}
+		if err := checkRange(q, float64(minutes)); err != nil {
+			return answer, err
+		}
+		answer.Number = float64(minutes)
+	case YesNo:
+		switch strings.ToLower(input) {
+		case "yes", "y", "true":
+			answer.Bool = true
+		case "no", "n", "false":
+			answer.Bool = false
+		default:
+			return answer, errors.New("please answer yes or no")
+		}
+		answer.Text = answer.String()
+	default:
+		if len([]rune(input)) < q.MinLength {
+			return answer, errors.Errorf("please tell a bit more, at least %d characters", q.MinLength)
+		}
+	}
+
+	if q.pattern != nil && !q.pattern.MatchString(input) {
+		return answer, errors.Errorf("%q is not a valid answer, try again", input)
+	}
+
+	return answer, nil
+}
+
+// matchOption accepts an option by its text, case insensitive, or by its 1-based position.
+func matchOption(options []string, input string) (string, bool) {
+	for _, o := range options {
+		if strings.EqualFold(o, input) {
+			return o, true
+		}
+	}
+
+	if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(options) {
+		return options[n-1], true
+	}
+
+	return "", false
+}
+
+func checkRange(q Question, n float64) error {
+	if q.Min != nil && n < *q.Min {
+		return errors.Errorf("please enter at least %s", strconv.FormatFloat(*q.Min, 'f', -1, 64))
+	}
+
+	if q.Max != nil && n > *q.Max {
+		return errors.Errorf("please enter at most %s", strconv.FormatFloat(*q.Max, 'f', -1, 64))
+	}
+
+	return nil
+}
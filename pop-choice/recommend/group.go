@@ -0,0 +1,155 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"pop-choice/constants"
+	"pop-choice/group"
+	"pop-choice/models"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const (
+	GroupSchemaName            = "group_movie_recommendation"
+	GroupUserMessageTmpl       = "Context: %s\nGroup members:\n%s"
+	GroupStructuredInstruction = `Reply with the reason why this movie is a good pick for the whole group in "reason". For every member, in the given order, explain in "members" how the movie satisfies that person, and copy every answer of theirs the pick matches verbatim into "matched_answers".`
+)
+
+var groupSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"reason": map[string]any{
+			"type":        "string",
+			"description": "Short explanation of why this movie suits the group.",
+		},
+		"members": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"reason": map[string]any{
+						"type":        "string",
+						"description": "How the movie satisfies this member.",
+					},
+					"matched_answers": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+				},
+				"required":             []string{"name", "reason", "matched_answers"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"reason", "members"},
+	"additionalProperties": false,
+}
+
+type groupReply struct {
+	Reason  string `json:"reason"`
+	Members []struct {
+		Name           string   `json:"name"`
+		Reason         string   `json:"reason"`
+		MatchedAnswers []string `json:"matched_answers"`
+	} `json:"members"`
+}
+
+// RecommendForGroup explains how a ranked candidate satisfies the group and each of its members.
+func RecommendForGroup(
+	ctx context.Context,
+	openaiClient openai.Client,
+	systemPrompt string,
+	candidate group.Candidate,
+	members []group.Member,
+) (models.Recommendation, error) {
+	var sb strings.Builder
+	for _, m := range members {
+		sb.WriteString(fmt.Sprintf("%s:\n%s\n", m.Name, strings.Join(m.Answers, "\n")))
+	}
+
+	chatResp, err := openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(systemPrompt + " " + GroupStructuredInstruction),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf(GroupUserMessageTmpl, candidate.Content, sb.String())),
+						},
+					},
+				},
+			},
+			// Structured outputs are not supported by gpt-4.
+			Model:            openai.ChatModelGPT4o,
+			Temperature:      param.NewOpt(constants.Temperature),
+			PresencePenalty:  param.NewOpt(constants.PresencePenalty),
+			FrequencyPenalty: param.NewOpt(constants.FrequencyPenalty),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+					JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+						Name:   GroupSchemaName,
+						Strict: param.NewOpt(true),
+						Schema: groupSchema,
+					},
+				},
+			},
+		})
+	if err != nil {
+		return models.Recommendation{}, errors.Wrap(err, "failed to generate group pop choice movies response")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return models.Recommendation{}, errors.New("empty group pop choice movies response")
+	}
+
+	if refusal := chatResp.Choices[0].Message.Refusal; refusal != "" {
+		return models.Recommendation{}, errors.Errorf("model refused to recommend: %s", refusal)
+	}
+
+	var r groupReply
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &r); err != nil {
+		return models.Recommendation{}, errors.Wrap(err, "failed to parse group pop choice movies response")
+	}
+
+	// Members are matched by position, the scores are ours and not the model's.
+	fits := make([]models.MemberFit, len(members))
+	matched := make([]string, 0)
+	for i, m := range members {
+		fits[i] = models.MemberFit{
+			Name:           m.Name,
+			Similarity:     candidate.Scores[i],
+			MatchedAnswers: []string{},
+		}
+
+		if i < len(r.Members) {
+			fits[i].Reason = r.Members[i].Reason
+			fits[i].MatchedAnswers = keepAnswers(r.Members[i].MatchedAnswers, m.Answers)
+			matched = append(matched, fits[i].MatchedAnswers...)
+		}
+	}
+
+	return models.Recommendation{
+		MovieID:        candidate.ID,
+		Title:          candidate.Movie.Title,
+		ReleaseYear:    candidate.Movie.ReleaseYear,
+		RuntimeMinutes: candidate.Movie.RuntimeMinutes(),
+		Reason:         r.Reason,
+		MatchedAnswers: matched,
+		Similarity:     candidate.GroupScore,
+		Members:        fits,
+	}, nil
+}
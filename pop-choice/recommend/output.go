@@ -0,0 +1,60 @@
+package recommend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"pop-choice/models"
+)
+
+func FormatRuntime(minutes int) string {
+	switch {
+	case minutes == 0:
+		return ""
+	case minutes < 60:
+		return fmt.Sprintf("%d min", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d hr", minutes/60)
+	default:
+		return fmt.Sprintf("%d hr %d min", minutes/60, minutes%60)
+	}
+}
+
+func WriteText(w io.Writer, recommendations []models.Recommendation) error {
+	for i, r := range recommendations {
+		header := fmt.Sprintf("%d. %s", i+1, r.Title)
+		if r.ReleaseYear != "" {
+			header += fmt.Sprintf(" (%s)", r.ReleaseYear)
+		}
+		if runtime := FormatRuntime(r.RuntimeMinutes); runtime != "" {
+			header += " - " + runtime
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\n   Why: %s\n", header, r.Reason); err != nil {
+			return err
+		}
+
+		for _, m := range r.Members {
+			if _, err := fmt.Fprintf(w, "   %s (%.2f): %s\n", m.Name, m.Similarity, m.Reason); err != nil {
+				return err
+			}
+		}
+
+		if len(r.Members) == 0 && len(r.MatchedAnswers) > 0 {
+			if _, err := fmt.Fprintf(w, "   Matches: %s\n", strings.Join(r.MatchedAnswers, "; ")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func WriteJSON(w io.Writer, recommendations []models.Recommendation) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(map[string]any{"recommendations": recommendations})
+}
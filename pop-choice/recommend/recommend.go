@@ -0,0 +1,161 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"pop-choice/constants"
+	"pop-choice/models"
+	"pop-choice/models/db"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const (
+	SchemaName            = "movie_recommendation"
+	UserMessageTmpl       = "Context: %s\nUser interests:\n%s"
+	StructuredInstruction = `Reply with the reason why this movie is a good pick for the user in "reason", and copy every user answer the pick matches verbatim into "matched_answers".`
+)
+
+// schema is the strict JSON schema of the model's reply. The facts about the movie are
+// joined back in from the catalogue, so the model only writes what it is needed for.
+var schema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"reason": map[string]any{
+			"type":        "string",
+			"description": "Short explanation of why this movie suits the user's interests.",
+		},
+		"matched_answers": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "The user answers this movie matches, copied verbatim.",
+		},
+	},
+	"required":             []string{"reason", "matched_answers"},
+	"additionalProperties": false,
+}
+
+type reply struct {
+	Reason         string   `json:"reason"`
+	MatchedAnswers []string `json:"matched_answers"`
+}
+
+// Catalogue maps the embedded content of a movie back to the movie.
+type Catalogue map[string]models.Movie
+
+func NewCatalogue(movies []models.Movie) Catalogue {
+	c := make(Catalogue, len(movies))
+	for _, m := range movies {
+		c[m.ToString()] = m
+	}
+
+	return c
+}
+
+// Movie returns the movie a match was embedded from, falling back to parsing its content.
+func (c Catalogue) Movie(content string) models.Movie {
+	if m, ok := c[content]; ok {
+		return m
+	}
+
+	if m, ok := models.ParseMovie(content); ok {
+		return m
+	}
+
+	return models.Movie{Content: content}
+}
+
+// Recommend explains a single matched movie against the user's answers using structured outputs.
+func Recommend(
+	ctx context.Context,
+	openaiClient openai.Client,
+	catalogue Catalogue,
+	systemPrompt string,
+	match db.MatchedDocument,
+	answers []string,
+) (models.Recommendation, error) {
+	chatResp, err := openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(systemPrompt + " " + StructuredInstruction),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf(UserMessageTmpl, match.Content, strings.Join(answers, "\n"))),
+						},
+					},
+				},
+			},
+			// Structured outputs are not supported by gpt-4.
+			Model:            openai.ChatModelGPT4o,
+			Temperature:      param.NewOpt(constants.Temperature),
+			PresencePenalty:  param.NewOpt(constants.PresencePenalty),
+			FrequencyPenalty: param.NewOpt(constants.FrequencyPenalty),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+					JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+						Name:   SchemaName,
+						Strict: param.NewOpt(true),
+						Schema: schema,
+					},
+				},
+			},
+		})
+	if err != nil {
+		return models.Recommendation{}, errors.Wrap(err, "failed to generate pop choice movies response")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return models.Recommendation{}, errors.New("empty pop choice movies response")
+	}
+
+	if refusal := chatResp.Choices[0].Message.Refusal; refusal != "" {
+		return models.Recommendation{}, errors.Errorf("model refused to recommend: %s", refusal)
+	}
+
+	var r reply
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &r); err != nil {
+		return models.Recommendation{}, errors.Wrap(err, "failed to parse pop choice movies response")
+	}
+
+	movie := catalogue.Movie(match.Content)
+
+	return models.Recommendation{
+		MovieID:        match.ID,
+		Title:          movie.Title,
+		ReleaseYear:    movie.ReleaseYear,
+		RuntimeMinutes: movie.RuntimeMinutes(),
+		Reason:         r.Reason,
+		MatchedAnswers: keepAnswers(r.MatchedAnswers, answers),
+		Similarity:     match.Similarity,
+	}, nil
+}
+
+// keepAnswers drops matched answers the user never gave, the model sometimes paraphrases them.
+func keepAnswers(matched, answers []string) []string {
+	given := make(map[string]bool, len(answers))
+	for _, a := range answers {
+		given[strings.TrimSpace(a)] = true
+	}
+
+	kept := make([]string, 0, len(matched))
+	for _, m := range matched {
+		if given[strings.TrimSpace(m)] {
+			kept = append(kept, strings.TrimSpace(m))
+		}
+	}
+
+	return kept
+}
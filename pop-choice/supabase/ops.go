@@ -1,6 +1,8 @@
 package supabase
 
 import (
+	"strconv"
+
 	"pop-choice/constants"
 	"pop-choice/models"
 	"pop-choice/models/db"
@@ -23,6 +25,42 @@ func InsertDocument(
 	return results, nil
 }
 
+func InsertDocuments(
+	tableName string,
+	dbClient *supa.Client,
+	docs []models.Vector,
+) ([]db.Document, error) {
+	var results []db.Document
+
+	err := dbClient.DB.From(tableName).Insert(docs).Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func UpdateDocument(
+	tableName string,
+	dbClient *supa.Client,
+	id int,
+	doc models.Vector,
+) ([]db.Document, error) {
+	var results []db.Document
+
+	err := dbClient.
+		DB.
+		From(tableName).
+		Update(doc).
+		Eq(constants.PopChoiceTblIDColumnName, strconv.Itoa(id)).
+		Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
 func ReadDocumentByContent(
 	tableName string,
 	dbClient *supa.Client,
@@ -43,16 +81,52 @@ func ReadDocumentByContent(
 	return results, nil
 }
 
+// ReadDocuments reads the id and content of every row, page by page, as PostgREST caps the rows of a single response.
 func ReadDocuments(
 	tableName string,
 	dbClient *supa.Client,
+) ([]db.Document, error) {
+	results := make([]db.Document, 0)
+
+	for offset := 0; ; offset += constants.ReadPageSize {
+		var page []db.Document
+
+		err := dbClient.
+			DB.
+			From(tableName).
+			Select(constants.PopChoiceTblKeyColumnNames).
+			OrderBy(constants.PopChoiceTblIDColumnName, "asc").
+			LimitWithOffset(constants.ReadPageSize, offset).
+			Execute(&page)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, page...)
+
+		if len(page) < constants.ReadPageSize {
+			return results, nil
+		}
+	}
+}
+
+func ReadDocumentsByIDs(
+	tableName string,
+	dbClient *supa.Client,
+	ids []int,
 ) ([]db.Document, error) {
 	var results []db.Document
 
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.Itoa(id)
+	}
+
 	err := dbClient.
 		DB.
 		From(tableName).
-		Select(constants.PopChoiceTblContentColumnName).
+		Select(constants.PopChoiceTblColumnNames).
+		In(constants.PopChoiceTblIDColumnName, values).
 		Execute(&results)
 	if err != nil {
 		return nil, err
@@ -81,3 +155,24 @@ func InvokeMatchFunction(
 
 	return results, nil
 }
+
+// ReadEmbeddingDimensions returns the size the table's embedding column was declared with, 0 when unknown.
+func ReadEmbeddingDimensions(
+	dbClient *supa.Client,
+	tableName string,
+) (int, error) {
+	var dimensions *int
+
+	err := dbClient.DB.Rpc(constants.EmbeddingDimensionsFunctionName, map[string]any{
+		"table_name": tableName,
+	}).Execute(&dimensions)
+	if err != nil {
+		return 0, err
+	}
+
+	if dimensions == nil {
+		return 0, nil
+	}
+
+	return *dimensions, nil
+}
@@ -0,0 +1,11 @@
+module readability
+
+go 1.24.1
+
+require (
+	github.com/PuerkitoBio/goquery v1.10.2
+	github.com/pkg/errors v0.9.1
+	golang.org/x/net v0.37.0
+)
+
+require github.com/andybalholm/cascadia v1.3.3 // indirect
@@ -0,0 +1,258 @@
+// Package readability extracts the readable text of an HTML page: its title and the
+// paragraphs of its main content, without scripts, navigation and other boilerplate.
+package readability
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// MinNavLinks and MaxLinkDensity decide when a list or block is navigation: it has at
+	// least MinNavLinks links and more than MaxLinkDensity of its text is link text.
+	MinNavLinks    = 3
+	MaxLinkDensity = 0.7
+)
+
+// removed are never part of the content. Form controls are, but not forms, as some pages,
+// e.g. ASP.NET WebForms, wrap their whole body in one. Headers and footers only count as
+// boilerplate outside of the main content, see removeBoilerplate.
+const removed = "script, style, noscript, template, iframe, object, embed, svg, canvas, " +
+	"button, input, select, textarea, nav, aside, menu, dialog, " +
+	"[hidden], [aria-hidden=true], [role=navigation], [role=banner], [role=contentinfo], " +
+	"[role=complementary], [role=search]"
+
+var boilerplateAttr = regexp.MustCompile(`(?i)(^|[-_\s])(nav|navbar|navigation|menu|breadcrumbs?|footer|sidebar|cookies?|banner|share|social|skip|pagination|toolbar|masthead)([-_\s]|$)`)
+
+type Article struct {
+	Title      string
+	Paragraphs []string
+}
+
+// Text joins the paragraphs with blank lines, without the title.
+func (a Article) Text() string {
+	return strings.Join(a.Paragraphs, "\n\n")
+}
+
+// Parse reads an HTML document and extracts its article.
+func Parse(r io.Reader) (Article, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return Article{}, errors.Wrap(err, "failed to parse HTML")
+	}
+
+	return FromSelection(doc.Selection), nil
+}
+
+// FromSelection extracts the article of a parsed document, e.g. the DOM of a colly
+// HTMLElement. The selection itself is left as it is.
+func FromSelection(s *goquery.Selection) Article {
+	doc := s.Clone()
+
+	article := Article{Title: title(doc)}
+
+	removeBoilerplate(doc)
+
+	var b builder
+	for _, n := range content(doc).Nodes {
+		b.walk(n)
+	}
+	b.flush()
+
+	article.Paragraphs = b.paragraphs
+
+	return article
+}
+
+func title(doc *goquery.Selection) string {
+	for _, sel := range []string{"title", `meta[property="og:title"]`, "h1"} {
+		s := doc.Find(sel).First()
+
+		text := s.Text()
+		if sel == `meta[property="og:title"]` {
+			text = s.AttrOr("content", "")
+		}
+
+		if text = strings.Join(strings.Fields(text), " "); text != "" {
+			return text
+		}
+	}
+
+	return ""
+}
+
+func removeBoilerplate(doc *goquery.Selection) {
+	doc.Find(removed).Remove()
+
+	doc.Find("header, footer").Each(func(_ int, s *goquery.Selection) {
+		if s.ParentsFiltered("article, main, [role=main]").Length() == 0 {
+			s.Remove()
+		}
+	})
+
+	doc.Find("[class], [id]").Each(func(_ int, s *goquery.Selection) {
+		if s.Is("html, body, main, article, [role=main]") {
+			return
+		}
+
+		if boilerplateAttr.MatchString(s.AttrOr("class", "")) || boilerplateAttr.MatchString(s.AttrOr("id", "")) {
+			s.Remove()
+		}
+	})
+
+	doc.Find("ul, ol, dl, table, div, section, p").Each(func(_ int, s *goquery.Selection) {
+		links := s.Find("a")
+		if links.Length() < MinNavLinks {
+			return
+		}
+
+		total := textLength(s.Text())
+		if total == 0 {
+			return
+		}
+
+		if float64(textLength(links.Text()))/float64(total) > MaxLinkDensity {
+			s.Remove()
+		}
+	})
+}
+
+// content picks the main content of the page: its main element, or its only article,
+// or else the whole body.
+func content(doc *goquery.Selection) *goquery.Selection {
+	if main := doc.Find("main, [role=main]").First(); main.Length() > 0 && textLength(main.Text()) > 0 {
+		return main
+	}
+
+	if articles := doc.Find("article"); articles.Length() == 1 && textLength(articles.Text()) > 0 {
+		return articles
+	}
+
+	if body := doc.Find("body"); body.Length() > 0 {
+		return body
+	}
+
+	return doc
+}
+
+func textLength(text string) int {
+	return len(strings.Join(strings.Fields(text), " "))
+}
+
+// builder collects paragraphs while walking the DOM. Block elements end the current
+// paragraph, inline elements and text continue it.
+type builder struct {
+	paragraphs []string
+	current    strings.Builder
+	space      bool
+	pre        int
+}
+
+func (b *builder) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.write(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch {
+	case n.DataAtom == atom.Br:
+		b.newline()
+		return
+
+	case n.DataAtom == atom.Hr || n.DataAtom == atom.Img:
+		b.flush()
+		return
+
+	case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+		b.space = true
+
+	case n.DataAtom == atom.Pre:
+		b.flush()
+		b.pre++
+		defer func() {
+			b.flush()
+			b.pre--
+		}()
+
+	case isBlock(n.DataAtom):
+		b.flush()
+		defer b.flush()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.walk(c)
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Dl, atom.Dt, atom.Dd,
+		atom.Blockquote, atom.Figure, atom.Figcaption, atom.Address, atom.Details, atom.Summary,
+		atom.Table, atom.Caption, atom.Thead, atom.Tbody, atom.Tfoot, atom.Tr:
+		return true
+	default:
+		return false
+	}
+}
+
+// write collapses whitespace into single spaces, except in preformatted text.
+func (b *builder) write(text string) {
+	if b.pre > 0 {
+		b.current.WriteString(text)
+		return
+	}
+
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			b.space = true
+			continue
+		}
+
+		if b.space && b.current.Len() > 0 && !strings.HasSuffix(b.current.String(), "\n") {
+			b.current.WriteByte(' ')
+		}
+		b.space = false
+		b.current.WriteRune(r)
+	}
+}
+
+func (b *builder) newline() {
+	b.current.WriteByte('\n')
+	b.space = false
+}
+
+func (b *builder) flush() {
+	text := b.current.String()
+	b.current.Reset()
+	b.space = false
+
+	if b.pre == 0 {
+		lines := strings.Split(text, "\n")
+		kept := lines[:0]
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				kept = append(kept, line)
+			}
+		}
+		text = strings.Join(kept, "\n")
+	} else {
+		text = strings.Trim(text, "\n")
+	}
+
+	if strings.TrimSpace(text) != "" {
+		b.paragraphs = append(b.paragraphs, text)
+	}
+}
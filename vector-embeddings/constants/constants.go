@@ -136,10 +136,24 @@ Chronicling the journey of a writer's renowned fictional tale, 'Asteroid City' u
 
 // Supabase
 const (
+	DefaultMatchThreshold = 0.50
+
 	DocumentsTblName              = "documents"
 	DocumentsTblContentColumnName = "content"
 	MatchDocumentsFunctionName    = "match_documents"
+	KwMatchDocumentsFunctionName  = "kw_match_documents"
+
+	MoviesTblName             = "movies"
+	MatchMoviesFunctionName   = "match_movies"
+	KwMatchMoviesFunctionName = "kw_match_movies"
 
-	MoviesTblName           = "movies"
-	MatchMoviesFunctionName = "match_movies"
+	EmbeddingDimensionsFunctionName = "embedding_dimensions"
+)
+
+// Sync
+const (
+	// KeyColumnNames are read from the documents and movies tables to plan a sync.
+	KeyColumnNames = "id,parent_id,chunk_index,content_hash"
+	// ReadPageSize is the number of rows read per request, Supabase's default maximum.
+	ReadPageSize = 1000
 )
@@ -0,0 +1,60 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+type Target string
+
+const (
+	DocumentsTarget Target = "documents"
+	MoviesTarget    Target = "movies"
+)
+
+// Dataset is a labelled set of queries and the parent IDs of the records that should be retrieved for them.
+type Dataset struct {
+	Name    string          `json:"name"`
+	Target  Target          `json:"target"`
+	Queries []LabelledQuery `json:"queries"`
+}
+
+type LabelledQuery struct {
+	Query    string   `json:"query"`
+	Expected []string `json:"expected"`
+}
+
+func LoadDataset(path string) (Dataset, error) {
+	var ds Dataset
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ds, errors.Wrap(err, "failed to read eval set")
+	}
+
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return ds, errors.Wrap(err, "failed to parse eval set")
+	}
+
+	switch ds.Target {
+	case DocumentsTarget, MoviesTarget:
+	default:
+		return ds, fmt.Errorf("invalid eval set target: %q", ds.Target)
+	}
+
+	if len(ds.Queries) == 0 {
+		return ds, errors.New("eval set has no queries")
+	}
+
+	for i, q := range ds.Queries {
+		if q.Query == "" || len(q.Expected) == 0 || slices.Contains(q.Expected, "") {
+			return ds, fmt.Errorf("eval set query %d needs a query and at least one non-empty expected document", i+1)
+		}
+	}
+
+	return ds, nil
+}
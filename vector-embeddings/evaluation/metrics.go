@@ -0,0 +1,50 @@
+package evaluation
+
+import "math"
+
+// All metrics use binary relevance over parent IDs: a retrieved chunk is relevant when its record is expected.
+
+func RecallAtK(ranked []string, expected map[string]bool, k int) float64 {
+	if len(expected) == 0 {
+		return 0
+	}
+
+	hits := 0
+	for i := 0; i < k && i < len(ranked); i++ {
+		if expected[ranked[i]] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(expected))
+}
+
+func ReciprocalRank(ranked []string, expected map[string]bool, k int) float64 {
+	for i := 0; i < k && i < len(ranked); i++ {
+		if expected[ranked[i]] {
+			return 1 / float64(i+1)
+		}
+	}
+
+	return 0
+}
+
+func NDCGAtK(ranked []string, expected map[string]bool, k int) float64 {
+	dcg := 0.0
+	for i := 0; i < k && i < len(ranked); i++ {
+		if expected[ranked[i]] {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+
+	idcg := 0.0
+	for i := 0; i < k && i < len(expected); i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	if idcg == 0 {
+		return 0
+	}
+
+	return dcg / idcg
+}
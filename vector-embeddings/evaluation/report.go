@@ -0,0 +1,34 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+func (r Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Eval set: %s (%s, %d queries, hybrid: %t, rerank: %t)\n\n", r.Dataset, r.Target, r.Queries, r.Hybrid, r.Rerank)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "THRESHOLD\tK\tRECALL@K\tMRR\tNDCG@K\t")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%.2f\t%d\t%.3f\t%.3f\t%.3f\t\n", res.Threshold, res.K, res.Recall, res.MRR, res.NDCG)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nSuggested settings: -threshold=%.2f -matches=%d (recall@k %.3f, MRR %.3f, nDCG@k %.3f)\n",
+		r.Suggestion.Threshold, r.Suggestion.K, r.Suggestion.Recall, r.Suggestion.MRR, r.Suggestion.NDCG)
+
+	return err
+}
+
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
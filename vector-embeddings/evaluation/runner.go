@@ -0,0 +1,188 @@
+package evaluation
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"vector-embeddings/retrieval"
+
+	"github.com/pkg/errors"
+)
+
+// Settings within this margin of the best nDCG count as equally good when suggesting one.
+const suggestionTolerance = 0.01
+
+type Options struct {
+	Thresholds []float64
+	Ks         []int
+	Hybrid     bool
+	Rerank     bool
+}
+
+type Report struct {
+	Dataset    string    `json:"dataset"`
+	Target     Target    `json:"target"`
+	RunAt      time.Time `json:"runAt"`
+	Hybrid     bool      `json:"hybrid"`
+	Rerank     bool      `json:"rerank"`
+	Queries    int       `json:"queries"`
+	Results    []Result  `json:"results"`
+	Suggestion Result    `json:"suggestion"`
+}
+
+type Result struct {
+	Threshold float64 `json:"threshold"`
+	K         int     `json:"k"`
+	Recall    float64 `json:"recall"`
+	MRR       float64 `json:"mrr"`
+	NDCG      float64 `json:"ndcg"`
+}
+
+func Run(
+	ctx context.Context,
+	retriever *retrieval.Retriever,
+	ds Dataset,
+	opts Options,
+) (Report, error) {
+	report := Report{
+		Dataset: ds.Name,
+		Target:  ds.Target,
+		RunAt:   time.Now().UTC(),
+		Hybrid:  opts.Hybrid,
+		Rerank:  opts.Rerank,
+		Queries: len(ds.Queries),
+	}
+
+	if len(opts.Thresholds) == 0 || len(opts.Ks) == 0 {
+		return report, errors.New("at least one threshold and one k are required")
+	}
+
+	sums := make(map[float64]map[int]*Result)
+	for _, t := range opts.Thresholds {
+		sums[t] = make(map[int]*Result)
+		for _, k := range opts.Ks {
+			sums[t][k] = &Result{Threshold: t, K: k}
+		}
+	}
+
+	// Searches with the same candidate pool rank the same candidates, so ks that share one
+	// are scored on the first k matches of a single search for the largest of them.
+	poolKs := make(map[int]int)
+	for _, k := range opts.Ks {
+		pool := retriever.PoolSize(k)
+		if k > poolKs[pool] {
+			poolKs[pool] = k
+		}
+	}
+
+	for _, q := range ds.Queries {
+		embedding, err := retriever.Embed(ctx, q.Query)
+		if err != nil {
+			return report, err
+		}
+
+		expected := make(map[string]bool)
+		for _, e := range q.Expected {
+			expected[e] = true
+		}
+
+		for _, t := range opts.Thresholds {
+			ranked := make(map[int][]string)
+			for pool, k := range poolKs {
+				candidates, err := retriever.Search(ctx, q.Query, embedding, k, t)
+				if err != nil {
+					return report, errors.Wrapf(err, "failed to retrieve for %q", q.Query)
+				}
+
+				ranked[pool] = chunkRecords(candidates)
+			}
+
+			for _, k := range opts.Ks {
+				records := ranked[retriever.PoolSize(k)]
+				r := sums[t][k]
+				r.Recall += RecallAtK(records, expected, k)
+				r.MRR += ReciprocalRank(records, expected, k)
+				r.NDCG += NDCGAtK(records, expected, k)
+			}
+		}
+	}
+
+	n := float64(len(ds.Queries))
+	for _, t := range opts.Thresholds {
+		for _, k := range opts.Ks {
+			r := sums[t][k]
+			r.Recall /= n
+			r.MRR /= n
+			r.NDCG /= n
+			report.Results = append(report.Results, *r)
+		}
+	}
+
+	sort.Slice(report.Results, func(i, j int) bool {
+		if report.Results[i].Threshold != report.Results[j].Threshold {
+			return report.Results[i].Threshold < report.Results[j].Threshold
+		}
+
+		return report.Results[i].K < report.Results[j].K
+	})
+
+	report.Suggestion = suggest(report.Results)
+
+	return report, nil
+}
+
+// suggest picks the strictest threshold and the smallest k that keep nDCG within
+// suggestionTolerance of the best result, i.e. the least context for the same quality.
+func suggest(results []Result) Result {
+	best := 0.0
+	for _, r := range results {
+		if r.NDCG > best {
+			best = r.NDCG
+		}
+	}
+
+	var suggestion Result
+	found := false
+	for _, r := range results {
+		if r.NDCG < best-suggestionTolerance {
+			continue
+		}
+
+		if !found ||
+			r.Threshold > suggestion.Threshold ||
+			(r.Threshold == suggestion.Threshold && r.K < suggestion.K) {
+			suggestion = r
+			found = true
+		}
+	}
+
+	return suggestion
+}
+
+// chunkRecords maps every retrieved chunk to the ID of its record, so that k counts
+// chunks like -matches does. Rows without a parent_id are records of their own and are
+// identified by their row ID. Further chunks of a record already seen map to "" and are
+// never relevant, so a record is only credited once.
+func chunkRecords(candidates []retrieval.Candidate) []string {
+	records := make([]string, 0, len(candidates))
+	seen := make(map[string]bool)
+
+	for _, c := range candidates {
+		id := c.ParentID
+		if id == "" {
+			id = strconv.Itoa(c.ID)
+		}
+
+		if seen[id] {
+			id = ""
+		} else {
+			seen[id] = true
+		}
+
+		records = append(records, id)
+	}
+
+	return records
+}
@@ -0,0 +1,122 @@
+package grounding
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vector-embeddings/retrieval"
+)
+
+const (
+	DontKnowAnswer = "Sorry, I don't know the answer."
+
+	CitationInstruction = ` Every context entry starts with a source number such as [1]. End each sentence that uses the context with the source numbers it relies on, e.g. [1] or [1][3].`
+)
+
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+type Citation struct {
+	Source     int     `json:"source"`
+	ID         int     `json:"id"`
+	ParentID   string  `json:"parentId,omitempty"`
+	Similarity float64 `json:"similarity"`
+	Score      float64 `json:"score"`
+}
+
+type Answer struct {
+	Question    string                `json:"question"`
+	Answer      string                `json:"answer"`
+	Abstained   bool                  `json:"abstained"`
+	Citations   []Citation            `json:"citations"`
+	Unsupported []string              `json:"unsupported,omitempty"`
+	Warnings    []string              `json:"warnings,omitempty"`
+	Retrieval   []retrieval.Candidate `json:"retrieval"`
+}
+
+// BuildContext numbers the candidates so that the model can cite them, [1] being the best match.
+func BuildContext(candidates []retrieval.Candidate) string {
+	var sb strings.Builder
+	for i, c := range candidates {
+		sb.WriteString(fmt.Sprintf("\n[%d] %s", i+1, c.Content))
+	}
+
+	return sb.String()
+}
+
+func ExtractCitations(
+	answer string,
+	candidates []retrieval.Candidate,
+) []Citation {
+	seen := make(map[int]bool)
+	citations := make([]Citation, 0)
+
+	for _, m := range citationMarker.FindAllStringSubmatch(answer, -1) {
+		source, err := strconv.Atoi(m[1])
+		if err != nil || source < 1 || source > len(candidates) || seen[source] {
+			continue
+		}
+		seen[source] = true
+
+		c := candidates[source-1]
+		citations = append(citations, Citation{
+			Source:     source,
+			ID:         c.ID,
+			ParentID:   c.ParentID,
+			Similarity: c.Similarity,
+			Score:      c.Score,
+		})
+	}
+
+	sort.Slice(citations, func(i, j int) bool {
+		return citations[i].Source < citations[j].Source
+	})
+
+	return citations
+}
+
+func IsAbstention(answer string) bool {
+	return strings.Contains(strings.ToLower(answer), "sorry, i don't know")
+}
+
+// NewAnswer collects the citations of a completion and checks it against the
+// "say you don't know" rule: an answer has to either abstain or cite the context.
+func NewAnswer(
+	question string,
+	answer string,
+	candidates []retrieval.Candidate,
+) Answer {
+	a := Answer{
+		Question:  question,
+		Answer:    answer,
+		Abstained: IsAbstention(answer),
+		Citations: ExtractCitations(answer, candidates),
+		Retrieval: candidates,
+	}
+
+	if a.Retrieval == nil {
+		a.Retrieval = make([]retrieval.Candidate, 0)
+	}
+
+	switch {
+	case len(candidates) == 0 && !a.Abstained:
+		a.Warnings = append(a.Warnings, "answered without any retrieved context")
+	case !a.Abstained && len(a.Citations) == 0:
+		a.Warnings = append(a.Warnings, "answer does not cite any retrieved document")
+	}
+
+	return a
+}
+
+// Abstain is the answer for a question that retrieved nothing, no model call is needed for it.
+func Abstain(question string) Answer {
+	return Answer{
+		Question:  question,
+		Answer:    DontKnowAnswer,
+		Abstained: true,
+		Citations: make([]Citation, 0),
+		Retrieval: make([]retrieval.Candidate, 0),
+	}
+}
@@ -0,0 +1,38 @@
+package grounding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+func (a Answer) WriteText(w io.Writer) error {
+	fmt.Fprintln(w, a.Answer)
+
+	if len(a.Citations) > 0 {
+		fmt.Fprintln(w, "\nSources:")
+		for _, c := range a.Citations {
+			fmt.Fprintf(w, "  [%d] id: %d, record: %s, similarity: %.3f, score: %.3f\n", c.Source, c.ID, c.ParentID, c.Similarity, c.Score)
+		}
+	}
+
+	if len(a.Unsupported) > 0 {
+		fmt.Fprintln(w, "\nNot supported by the retrieved context:")
+		for _, s := range a.Unsupported {
+			fmt.Fprintf(w, "  - %s\n", s)
+		}
+	}
+
+	for _, warning := range a.Warnings {
+		fmt.Fprintf(w, "\nWarning: %s\n", warning)
+	}
+
+	return nil
+}
+
+func (a Answer) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(a)
+}
@@ -0,0 +1,119 @@
+package grounding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"vector-embeddings/langchain"
+	"vector-embeddings/retrieval"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const VerifierSystemMessage = `You are a fact checker. You will be given some context and a numbered list of sentences from an answer based on that context. For every sentence decide whether it is supported by the context. Greetings, sentences saying the answer is unknown and sentences without factual claims count as supported. Reply only with JSON in the form {"sentences": [{"index": <sentence number>, "supported": <true|false>}]} and include every sentence.`
+
+// leadingCitations matches the markers at the start of a sentence, e.g. the "[1]" of
+// "foo. [1] Bar", which cite the sentence before them.
+var leadingCitations = regexp.MustCompile(`^(\s*\[\d+\])+`)
+
+type Verifier struct {
+	openaiClient openai.Client
+}
+
+func NewVerifier(openaiClient openai.Client) *Verifier {
+	return &Verifier{openaiClient: openaiClient}
+}
+
+type verdicts struct {
+	Sentences []struct {
+		Index     int  `json:"index"`
+		Supported bool `json:"supported"`
+	} `json:"sentences"`
+}
+
+// Unsupported returns the sentences of the answer that the retrieved context does not support.
+func (v *Verifier) Unsupported(
+	ctx context.Context,
+	answer string,
+	candidates []retrieval.Candidate,
+) ([]string, error) {
+	sentences := answerSentences(answer)
+	if len(sentences) == 0 {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	for i, s := range sentences {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, citationMarker.ReplaceAllString(s, "")))
+	}
+
+	chatResp, err := v.openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(VerifierSystemMessage),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf("Context:%s\n\nSentences:\n%s", BuildContext(candidates), sb.String())),
+						},
+					},
+				},
+			},
+			Model:       openai.ChatModelGPT4o,
+			Temperature: param.NewOpt(0.0),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &openai.ResponseFormatJSONObjectParam{},
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify answer")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, errors.New("empty verification response")
+	}
+
+	var res verdicts
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &res); err != nil {
+		return nil, errors.Wrap(err, "failed to parse verification response")
+	}
+
+	unsupported := make([]string, 0)
+	for _, s := range res.Sentences {
+		if !s.Supported && s.Index >= 1 && s.Index <= len(sentences) {
+			unsupported = append(unsupported, sentences[s.Index-1])
+		}
+	}
+
+	return unsupported, nil
+}
+
+// answerSentences splits the answer into sentences, with citations placed after a period
+// moved back to the sentence they cite.
+func answerSentences(answer string) []string {
+	sentences := make([]string, 0)
+	for _, s := range langchain.SplitSentences(answer) {
+		if m := leadingCitations.FindString(s); m != "" && len(sentences) > 0 {
+			sentences[len(sentences)-1] += " " + strings.TrimSpace(m)
+			s = strings.TrimSpace(s[len(m):])
+		}
+
+		if s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+
+	return sentences
+}
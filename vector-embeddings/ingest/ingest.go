@@ -0,0 +1,238 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"vector-embeddings/models"
+	"vector-embeddings/models/db"
+	"vector-embeddings/supabase"
+
+	supa "github.com/nedpals/supabase-go"
+	"github.com/pkg/errors"
+)
+
+// Row is a record or chunk as it should exist in a table, identified by its parent ID and chunk index.
+type Row struct {
+	ParentID   string
+	ChunkIndex int
+	Content    string
+}
+
+type Embed func(ctx context.Context, content string) ([]float64, error)
+
+type Plan struct {
+	New       []Row
+	Unchanged []Row
+	Updated   []Update
+	// Moved holds stored rows whose content now comes with another parent ID or chunk index,
+	// only their key columns are updated.
+	Moved    []Update
+	Orphaned []db.Document
+	// Duplicates are skipped, the unique constraint on content_hash allows identical content only once.
+	Duplicates []Row
+}
+
+type Update struct {
+	ID  int
+	Row Row
+}
+
+type Status struct {
+	Table      string `json:"table"`
+	New        int    `json:"new"`
+	Unchanged  int    `json:"unchanged"`
+	Updated    int    `json:"updated"`
+	Moved      int    `json:"moved"`
+	Orphaned   int    `json:"orphaned"`
+	Duplicates int    `json:"duplicates"`
+}
+
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func key(parentID string, chunkIndex int) string {
+	return fmt.Sprintf("%s#%d", parentID, chunkIndex)
+}
+
+// NewPlan compares the rows a source produces with the rows stored in a table.
+// A row whose content hash is already stored is unchanged, or moved when it is stored
+// under another key, a row whose key is stored with a different hash is updated, anything
+// else is new. Stored rows that no row claimed are orphaned, i.e. their source disappeared.
+func NewPlan(
+	rows []Row,
+	existing []db.Document,
+) Plan {
+	var plan Plan
+
+	byHash := make(map[string]db.Document)
+	byKey := make(map[string]db.Document)
+	for _, d := range existing {
+		if d.ContentHash != "" {
+			byHash[d.ContentHash] = d
+		}
+		if d.ParentID != "" {
+			byKey[key(d.ParentID, d.ChunkIndex)] = d
+		}
+	}
+
+	claimed := make(map[int]bool)
+	seenHashes := make(map[string]bool)
+
+	// Content is matched by hash first, so that a row inserted before others doesn't take
+	// over the key of a row that only moved.
+	rest := make([]Row, 0)
+	for _, r := range rows {
+		hash := ContentHash(r.Content)
+
+		if seenHashes[hash] {
+			plan.Duplicates = append(plan.Duplicates, r)
+			continue
+		}
+		seenHashes[hash] = true
+
+		if d, ok := byHash[hash]; ok {
+			claimed[d.ID] = true
+			if d.ParentID == r.ParentID && d.ChunkIndex == r.ChunkIndex {
+				plan.Unchanged = append(plan.Unchanged, r)
+			} else {
+				plan.Moved = append(plan.Moved, Update{ID: d.ID, Row: r})
+			}
+			continue
+		}
+
+		rest = append(rest, r)
+	}
+
+	for _, r := range rest {
+		if d, ok := byKey[key(r.ParentID, r.ChunkIndex)]; ok && !claimed[d.ID] {
+			claimed[d.ID] = true
+			plan.Updated = append(plan.Updated, Update{ID: d.ID, Row: r})
+			continue
+		}
+
+		plan.New = append(plan.New, r)
+	}
+
+	for _, d := range existing {
+		if !claimed[d.ID] {
+			plan.Orphaned = append(plan.Orphaned, d)
+		}
+	}
+
+	return plan
+}
+
+func (p Plan) Status(table string) Status {
+	return Status{
+		Table:      table,
+		New:        len(p.New),
+		Unchanged:  len(p.Unchanged),
+		Updated:    len(p.Updated),
+		Moved:      len(p.Moved),
+		Orphaned:   len(p.Orphaned),
+		Duplicates: len(p.Duplicates),
+	}
+}
+
+func Diff(
+	dbClient *supa.Client,
+	table string,
+	rows []Row,
+) (Plan, error) {
+	existing, err := supabase.ReadDocumentKeys(table, dbClient)
+	if err != nil {
+		return Plan{}, errors.Wrapf(err, "failed to read rows from %s", table)
+	}
+
+	return NewPlan(rows, existing), nil
+}
+
+// Sync makes the table match the rows: it embeds and inserts new rows, re-embeds and
+// replaces updated rows, re-keys moved rows and deletes orphaned rows. Unchanged and
+// moved rows cost no embedding.
+func Sync(
+	ctx context.Context,
+	dbClient *supa.Client,
+	table string,
+	rows []Row,
+	embed Embed,
+) (Status, error) {
+	plan, err := Diff(dbClient, table, rows)
+	if err != nil {
+		return Status{}, err
+	}
+
+	for _, r := range plan.Duplicates {
+		log.Printf("skipped %s #%d, its content is already in another row\n", r.ParentID, r.ChunkIndex)
+	}
+
+	for _, r := range plan.New {
+		v, err := vector(ctx, r, embed)
+		if err != nil {
+			return Status{}, err
+		}
+
+		if _, err := supabase.InsertDocument(table, dbClient, v); err != nil {
+			return Status{}, errors.Wrapf(err, "failed to insert embeddings for: '%s'", r.Content)
+		}
+
+		log.Printf("inserted %s #%d\n", r.ParentID, r.ChunkIndex)
+	}
+
+	for _, u := range plan.Updated {
+		v, err := vector(ctx, u.Row, embed)
+		if err != nil {
+			return Status{}, err
+		}
+
+		if _, err := supabase.UpdateDocument(table, dbClient, u.ID, v); err != nil {
+			return Status{}, errors.Wrapf(err, "failed to update embeddings for: '%s'", u.Row.Content)
+		}
+
+		log.Printf("updated %s #%d\n", u.Row.ParentID, u.Row.ChunkIndex)
+	}
+
+	for _, m := range plan.Moved {
+		if err := supabase.UpdateDocumentKey(table, dbClient, m.ID, m.Row.ParentID, m.Row.ChunkIndex); err != nil {
+			return Status{}, errors.Wrapf(err, "failed to move row %d to %s #%d", m.ID, m.Row.ParentID, m.Row.ChunkIndex)
+		}
+
+		log.Printf("moved %s #%d\n", m.Row.ParentID, m.Row.ChunkIndex)
+	}
+
+	orphanIDs := make([]int, 0, len(plan.Orphaned))
+	for _, d := range plan.Orphaned {
+		orphanIDs = append(orphanIDs, d.ID)
+	}
+
+	if err := supabase.DeleteDocuments(table, dbClient, orphanIDs); err != nil {
+		return Status{}, errors.Wrapf(err, "failed to delete orphaned rows from %s", table)
+	}
+
+	return plan.Status(table), nil
+}
+
+func vector(
+	ctx context.Context,
+	r Row,
+	embed Embed,
+) (models.Vector, error) {
+	embedding, err := embed(ctx, r.Content)
+	if err != nil {
+		return models.Vector{}, errors.Wrapf(err, "failed to generate embeddings for: '%s'", r.Content)
+	}
+
+	return models.Vector{
+		Content:     r.Content,
+		Embedding:   embedding,
+		ParentID:    r.ParentID,
+		ChunkIndex:  r.ChunkIndex,
+		ContentHash: ContentHash(r.Content),
+	}, nil
+}
@@ -1,14 +1,204 @@
 package langchain
 
-import "github.com/tmc/langchaingo/textsplitter"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+func init() {
+	// Use the embedded BPE ranks instead of downloading them on first use.
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+type Strategy string
+
+const (
+	RecursiveStrategy Strategy = "recursive"
+	RecordStrategy    Strategy = "record"
+	SentenceStrategy  Strategy = "sentence"
+	TokenStrategy     Strategy = "token"
+	MarkdownStrategy  Strategy = "markdown"
+
+	DefaultChunkSize    = 250
+	DefaultChunkOverlap = 15
+
+	SpaceSplitter = " "
+
+	// Same encoding as text-embedding-ada-002, so chunk sizes match what the embedding model sees.
+	EmbeddingEncoding = "cl100k_base"
+)
+
+type ChunkOptions struct {
+	Strategy Strategy
+	// ChunkSize is measured in tokens for TokenStrategy and in characters otherwise.
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+type Chunk struct {
+	ParentID string `json:"parentId"`
+	Index    int    `json:"index"`
+	Content  string `json:"content"`
+}
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case RecursiveStrategy, RecordStrategy, SentenceStrategy, TokenStrategy, MarkdownStrategy:
+		return Strategy(s), nil
+	}
+
+	return "", fmt.Errorf("invalid chunking strategy: %s", s)
+}
+
+// ChunkDocument splits the document with the selected strategy. The record strategy returns
+// one chunk per record, every other strategy splits the whole document, as the markdown
+// splitter needs its headings and blank lines. A chunk's ParentID is the ID of the record it
+// starts in, and Index counts the chunks of that record.
+func ChunkDocument(
+	document string,
+	opts ChunkOptions,
+) ([]Chunk, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+
+	if opts.ChunkOverlap < 0 || opts.ChunkOverlap >= opts.ChunkSize {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and chunk size (%d)", opts.ChunkSize)
+	}
+
+	records := SplitRecords(document)
+	chunks := make([]Chunk, 0)
+
+	if opts.Strategy == RecordStrategy {
+		for _, r := range records {
+			chunks = append(chunks, Chunk{ParentID: r.ID, Content: r.Content})
+		}
+
+		return chunks, nil
+	}
+
+	parts, err := splitDocument(document, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to split document with %s strategy", opts.Strategy)
+	}
+
+	doc := normalizeSpace(document)
+	starts := make([]int, len(records))
+	from := 0
+	for i, r := range records {
+		starts[i] = strings.Index(doc[from:], normalizeSpace(r.Content))
+		if starts[i] >= 0 {
+			starts[i] += from
+			from = starts[i]
+		}
+	}
+
+	counts := make(map[string]int)
+	parent := ""
+	from = 0
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		// chunks that can't be found in the document keep the record of the previous one
+		if pos := locate(doc, p, from); pos >= 0 {
+			from = pos
+			for i := range records {
+				if starts[i] >= 0 && starts[i] <= pos {
+					parent = records[i].ID
+				}
+			}
+		}
+
+		if parent == "" && len(records) > 0 {
+			parent = records[0].ID
+		}
+
+		chunks = append(chunks, Chunk{
+			ParentID: parent,
+			Index:    counts[parent],
+			Content:  p,
+		})
+		counts[parent]++
+	}
+
+	return chunks, nil
+}
+
+func splitDocument(
+	document string,
+	opts ChunkOptions,
+) ([]string, error) {
+	switch opts.Strategy {
+	case SentenceStrategy:
+		return packSentences(SplitSentences(document), opts.ChunkSize, opts.ChunkOverlap), nil
+
+	case TokenStrategy:
+		return textsplitter.NewTokenSplitter(
+			textsplitter.WithEncodingName(EmbeddingEncoding),
+			textsplitter.WithChunkSize(opts.ChunkSize),
+			textsplitter.WithChunkOverlap(opts.ChunkOverlap),
+		).SplitText(document)
+
+	case MarkdownStrategy:
+		return textsplitter.NewMarkdownTextSplitter(
+			textsplitter.WithChunkSize(opts.ChunkSize),
+			textsplitter.WithChunkOverlap(opts.ChunkOverlap),
+			textsplitter.WithHeadingHierarchy(true),
+		).SplitText(document)
+
+	case RecursiveStrategy, "":
+		return SplitDocuments(SpaceSplitter, document, opts.ChunkSize, opts.ChunkOverlap)
+	}
+
+	return nil, fmt.Errorf("invalid chunking strategy: %s", opts.Strategy)
+}
+
+// locate finds the text of a chunk in the whitespace normalised doc at or after from. Leading
+// headings are skipped, as the markdown splitter repeats the headings above a chunk. When the
+// text still isn't found, its leading lines are dropped one by one.
+func locate(doc, text string, from int) int {
+	lines := strings.Split(text, "\n")
+
+	first := 0
+	for first < len(lines)-1 && strings.HasPrefix(strings.TrimSpace(lines[first]), "#") {
+		first++
+	}
+
+	for i := first; i < len(lines); i++ {
+		needle := normalizeSpace(strings.Join(lines[i:], "\n"))
+		if needle == "" {
+			break
+		}
+
+		if pos := strings.Index(doc[from:], needle); pos >= 0 {
+			return from + pos
+		}
+	}
+
+	return -1
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
 
 func SplitDocuments(
 	splitter string,
-	document string) ([]string, error) {
+	document string,
+	chunkSize int,
+	chunkOverlap int) ([]string, error) {
 	recurCh := textsplitter.NewRecursiveCharacter(
 		textsplitter.WithSeparators([]string{splitter}),
-		textsplitter.WithChunkSize(250),
-		textsplitter.WithChunkOverlap(15),
+		textsplitter.WithChunkSize(chunkSize),
+		textsplitter.WithChunkOverlap(chunkOverlap),
 	)
 
 	return recurCh.SplitText(document)
@@ -0,0 +1,87 @@
+package langchain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Record struct {
+	ID      string
+	Content string
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SplitRecords splits a document on blank lines and markdown headings.
+// A heading line always opens a new record and stays attached to the text below it.
+func SplitRecords(document string) []Record {
+	blocks := make([]string, 0)
+	current := make([]string, 0)
+
+	flush := func() {
+		block := strings.TrimSpace(strings.Join(current, "\n"))
+		if block != "" {
+			blocks = append(blocks, block)
+		}
+		current = current[:0]
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			if !isHeadingOnly(current) {
+				flush()
+			}
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			current = append(current, line)
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	records := make([]Record, 0, len(blocks))
+	seen := make(map[string]int)
+
+	for i, b := range blocks {
+		id := RecordID(b)
+		if id == "" {
+			id = fmt.Sprintf("record-%d", i+1)
+		}
+
+		seen[id]++
+		if seen[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, seen[id])
+		}
+
+		records = append(records, Record{ID: id, Content: b})
+	}
+
+	return records
+}
+
+// RecordID derives a stable ID from the record title on its first line,
+// e.g. "Top Gun: Maverick: 2022 | PG-13 | 2h 10m | 8.3 rating" becomes "top-gun-maverick".
+func RecordID(record string) string {
+	title := strings.SplitN(strings.TrimSpace(record), "\n", 2)[0]
+	title = strings.TrimLeft(title, "# ")
+
+	if i := strings.Index(title, " | "); i > 0 {
+		title = title[:i]
+		if j := strings.LastIndex(title, ": "); j > 0 {
+			title = title[:j]
+		}
+	} else if i := strings.Index(title, ": "); i > 0 {
+		title = title[:i]
+	}
+
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+func isHeadingOnly(lines []string) bool {
+	return len(lines) == 1 && strings.HasPrefix(strings.TrimSpace(lines[0]), "#")
+}
@@ -0,0 +1,91 @@
+package langchain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A sentence ends with ., ! or ? (optionally followed by a closing quote) and whitespace.
+var sentenceBoundary = regexp.MustCompile(`([A-Za-z0-9]*)[.!?]["'”’]?\s+`)
+
+// Abbreviations that end with a period but do not end a sentence, e.g. "Lt. Gen. Leslie Groves Jr."
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true,
+	"jr": true, "sr": true, "st": true, "lt": true, "gen": true,
+	"col": true, "capt": true, "sgt": true, "vs": true, "etc": true,
+	"no": true, "mt": true, "inc": true, "ltd": true,
+}
+
+func SplitSentences(text string) []string {
+	sentences := make([]string, 0)
+
+	start := 0
+	for _, loc := range sentenceBoundary.FindAllStringSubmatchIndex(text, -1) {
+		word := text[loc[2]:loc[3]]
+		if strings.HasPrefix(text[loc[3]:], ".") && isAbbreviation(word) {
+			continue
+		}
+
+		s := strings.TrimSpace(text[start:loc[1]])
+		if s != "" {
+			sentences = append(sentences, s)
+		}
+		start = loc[1]
+	}
+
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+
+	return sentences
+}
+
+func isAbbreviation(word string) bool {
+	// initials such as the "J." in "J. Robert Oppenheimer"
+	if len(word) == 1 && word[0] >= 'A' && word[0] <= 'Z' {
+		return true
+	}
+
+	return abbreviations[strings.ToLower(word)]
+}
+
+// packSentences groups whole sentences into chunks of up to chunkSize characters.
+// A sentence longer than chunkSize becomes a chunk on its own rather than being cut.
+// Trailing sentences that fit within chunkOverlap are repeated at the start of the next chunk.
+func packSentences(
+	sentences []string,
+	chunkSize int,
+	chunkOverlap int,
+) []string {
+	chunks := make([]string, 0)
+	current := make([]string, 0)
+	currentLen := 0
+
+	for _, s := range sentences {
+		if currentLen > 0 && currentLen+1+len(s) > chunkSize {
+			chunks = append(chunks, strings.Join(current, " "))
+
+			overlap := make([]string, 0)
+			overlapLen := 0
+			for i := len(current) - 1; i >= 0; i-- {
+				if overlapLen+len(current[i]) > chunkOverlap {
+					break
+				}
+				overlap = append([]string{current[i]}, overlap...)
+				overlapLen += len(current[i]) + 1
+			}
+
+			current = overlap
+			currentLen = overlapLen
+		}
+
+		current = append(current, s)
+		currentLen += len(s) + 1
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, " "))
+	}
+
+	return chunks
+}
@@ -2,19 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"vector-embeddings/constants"
+	"vector-embeddings/evaluation"
+	"vector-embeddings/grounding"
+	"vector-embeddings/ingest"
 	"vector-embeddings/langchain"
-	"vector-embeddings/models"
 	openaipkg "vector-embeddings/openai"
+	"vector-embeddings/retrieval"
 	"vector-embeddings/supabase"
 
+	"embedder"
+
 	"github.com/caarlos0/env"
-	supa "github.com/nedpals/supabase-go"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/packages/param"
 	"github.com/pkg/errors"
@@ -30,8 +38,6 @@ const (
 	Temperature      = 1.1
 	PresencePenalty  = 0.0
 	FrequencyPenalty = 0.0
-
-	SpaceSplitter = " "
 )
 
 type envvars struct {
@@ -51,7 +57,7 @@ func main() {
 	actionFlag := flag.String(
 		"action",
 		"",
-		"Allowed values: insert-docs, search-docs, search-n-chat-docs, chunk-n-insert-movies.")
+		"Allowed values: insert-docs, search-docs, search-n-chat-docs, chunk-n-insert-movies, chunk-preview, query-movie, eval-retrieval, status.")
 	searchQueryFlag := flag.String(
 		"query",
 		"",
@@ -60,6 +66,54 @@ func main() {
 		"matches",
 		1,
 		"number of matches to be used in your query")
+	thresholdFlag := flag.Float64(
+		"threshold",
+		constants.DefaultMatchThreshold,
+		"minimum cosine similarity for a vector match")
+	hybridFlag := flag.Bool(
+		"hybrid",
+		false,
+		"combine keyword (full-text) search with vector search using reciprocal rank fusion")
+	rerankFlag := flag.Bool(
+		"rerank",
+		false,
+		"rerank the top candidates with an LLM before answering")
+	candidatesFlag := flag.Int(
+		"candidates",
+		10,
+		"number of candidates fetched from each search for fusion and reranking")
+	chunkingFlag := flag.String(
+		"chunking",
+		string(langchain.RecursiveStrategy),
+		"Allowed values: recursive, record, sentence, token, markdown.")
+	chunkSizeFlag := flag.Int(
+		"chunk-size",
+		langchain.DefaultChunkSize,
+		"maximum chunk size, in tokens for the token strategy and in characters otherwise")
+	chunkOverlapFlag := flag.Int(
+		"chunk-overlap",
+		langchain.DefaultChunkOverlap,
+		"overlap between neighbouring chunks of the same record")
+	verifyFlag := flag.Bool(
+		"verify",
+		false,
+		"check every sentence of the answer against the retrieved context, with a second model call")
+	evalSetFlag := flag.String(
+		"eval-set",
+		"",
+		"path to a labelled query to expected document set, e.g. data/movies_eval.json")
+	thresholdsFlag := flag.String(
+		"thresholds",
+		"0.5,0.7,0.75,0.8",
+		"comma separated match thresholds to sweep in eval-retrieval")
+	ksFlag := flag.String(
+		"ks",
+		"1,3,5",
+		"comma separated numbers of matches to sweep in eval-retrieval")
+	formatFlag := flag.String(
+		"format",
+		"text",
+		"Allowed values: text, json.")
 	flag.Parse()
 
 	action := ""
@@ -81,33 +135,131 @@ func main() {
 		matches = *matchesFlag
 	}
 
+	threshold := constants.DefaultMatchThreshold
+	if thresholdFlag != nil {
+		threshold = *thresholdFlag
+	}
+
+	hybrid := false
+	if hybridFlag != nil {
+		hybrid = *hybridFlag
+	}
+
+	rerank := false
+	if rerankFlag != nil {
+		rerank = *rerankFlag
+	}
+
+	candidates := 0
+	if candidatesFlag != nil {
+		candidates = *candidatesFlag
+	}
+
+	chunkOpts := langchain.ChunkOptions{
+		Strategy:     langchain.RecursiveStrategy,
+		ChunkSize:    langchain.DefaultChunkSize,
+		ChunkOverlap: langchain.DefaultChunkOverlap,
+	}
+	if chunkingFlag != nil {
+		strategy, err := langchain.ParseStrategy(*chunkingFlag)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		chunkOpts.Strategy = strategy
+	}
+
+	if chunkSizeFlag != nil {
+		chunkOpts.ChunkSize = *chunkSizeFlag
+	}
+
+	if chunkOverlapFlag != nil {
+		chunkOpts.ChunkOverlap = *chunkOverlapFlag
+	}
+
+	verify := false
+	if verifyFlag != nil {
+		verify = *verifyFlag
+	}
+
+	evalSet := ""
+	if evalSetFlag != nil {
+		evalSet = *evalSetFlag
+	}
+
+	thresholds := []float64{threshold}
+	if thresholdsFlag != nil {
+		parsed, err := parseFloats(*thresholdsFlag)
+		if err != nil {
+			log.Fatalln("invalid thresholds:", err)
+		}
+
+		thresholds = parsed
+	}
+
+	ks := []int{matches}
+	if ksFlag != nil {
+		parsed, err := parseInts(*ksFlag)
+		if err != nil {
+			log.Fatalln("invalid ks:", err)
+		}
+
+		ks = parsed
+	}
+
+	format := "text"
+	if formatFlag != nil {
+		format = *formatFlag
+	}
+
+	if format != "text" && format != "json" {
+		log.Fatalln("invalid format, allowed values: text, json")
+	}
+
 	openaiClient := openaipkg.NewOpenAiClient(envs.OpenApiKey)
 	supabaseClient := supabase.NewClient(envs.SupabaseProjectUrl, envs.SupabaseApiKey)
 
+	emb, logCacheStats, err := embedder.FromEnv(envs.OpenApiKey, log.Printf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logCacheStats()
+
+	// checkDimensions stops before embeddings of the wrong size reach table.
+	checkDimensions := func(table string) {
+		readDimensions := func(table string) (int, error) {
+			return supabase.ReadEmbeddingDimensions(supabaseClient, table)
+		}
+		if err := embedder.CheckTable(ctx, emb, table, readDimensions, log.Printf); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	var reranker retrieval.Reranker
+	if rerank {
+		reranker = retrieval.NewLLMReranker(openaiClient)
+	}
+
 	switch action {
 	case "insert-docs":
 		// go run main.go -action=insert-docs
+		// go run main.go -action=insert-docs -chunking=sentence -chunk-size=100
 
-		allDocsMap := fetchExistingRows(supabaseClient, constants.DocumentsTblName)
-
-		for _, p := range constants.Podcasts {
-			if _, ok := allDocsMap[p]; ok {
-				continue
-			}
-
-			docVector := getEmbeddings(ctx, openaiClient, []string{p})
-			if len(docVector) == 0 {
-				log.Printf("Failed to generate doc vector for: (%s)\n", p)
-			}
+		log.Printf("chunking podcasts with %s strategy....\n", chunkOpts.Strategy)
+		chunks, err := chunkPodcasts(chunkOpts)
+		if err != nil {
+			log.Fatalln("failed to split podcasts", err)
+		}
 
-			res, err := supabase.InsertDocument(constants.DocumentsTblName, supabaseClient, docVector[0])
-			if err != nil {
-				log.Fatalf("failed to insert embeddings for: '%s'\n: %v", docVector[0].Content, err)
-			}
+		checkDimensions(constants.DocumentsTblName)
 
-			log.Printf("len of docs: %d\n", len(res))
+		status, err := ingest.Sync(ctx, supabaseClient, constants.DocumentsTblName, chunkRows(chunks), ingestEmbed(emb))
+		if err != nil {
+			log.Fatalln("failed to sync podcast embeddings", err)
 		}
 
+		log.Printf("new: %d, unchanged: %d, updated: %d, moved: %d, deleted: %d, duplicates: %d\n", status.New, status.Unchanged, status.Updated, status.Moved, status.Orphaned, status.Duplicates)
+
 	case "search-docs":
 		// go run main.go -action=search-docs -query="Jammin' in the Big Easy"
 		// go run main.go -action=search-docs -query="Decoding orca calls"
@@ -117,31 +269,28 @@ func main() {
 			log.Fatalln("query cannot be empty for semantic search")
 		}
 
-		res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-			Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: openai.String(query),
-			},
+		checkDimensions(constants.DocumentsTblName)
+
+		retriever := retrieval.NewRetriever(emb, supabaseClient, retrieval.Config{
+			MatchFunctionName:   constants.MatchDocumentsFunctionName,
+			KwMatchFunctionName: constants.KwMatchDocumentsFunctionName,
+			MatchThreshold:      threshold,
+			Hybrid:              hybrid,
+			CandidatePool:       candidates,
+			Reranker:            reranker,
 		})
+
+		matchedDocs, err := retriever.Retrieve(ctx, query, 2)
 		if err != nil {
-			log.Fatalln("failed to generate embeddings", err)
+			log.Fatalln("failed to match documents for query", err)
 		}
 
-		if res != nil && len(res.Data) > 0 {
-			matchedDocs, err := supabase.InvokeMatchFunction(supabaseClient, constants.MatchDocumentsFunctionName, res.Data[0].Embedding, 2)
-			if err != nil {
-				log.Fatalln("failed to match documents for query", err)
-			}
-
-			if len(matchedDocs) == 0 {
-				log.Fatalln("no matching docs found")
-			}
+		if len(matchedDocs) == 0 {
+			log.Fatalln("no matching docs found")
+		}
 
-			for _, md := range matchedDocs {
-				log.Printf("matched doc: %s, \nsimilarity score: %v\n", md.Content, md.Similarity)
-			}
-		} else {
-			log.Fatalln("failed to generate embeddings for query", err)
+		for _, md := range matchedDocs {
+			log.Printf("matched doc: %s, \nsimilarity score: %v, score: %v\n", md.Content, md.Similarity, md.Score)
 		}
 
 	case "search-n-chat-docs":
@@ -154,94 +303,70 @@ func main() {
 			log.Fatalln("query cannot be empty for semantic search & chat")
 		}
 
-		res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-			Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: openai.String(query),
-			},
+		checkDimensions(constants.DocumentsTblName)
+
+		retriever := retrieval.NewRetriever(emb, supabaseClient, retrieval.Config{
+			MatchFunctionName:   constants.MatchDocumentsFunctionName,
+			KwMatchFunctionName: constants.KwMatchDocumentsFunctionName,
+			MatchThreshold:      threshold,
+			Hybrid:              hybrid,
+			CandidatePool:       candidates,
+			Reranker:            reranker,
 		})
+
+		matchedDocs, err := retriever.Retrieve(ctx, query, matches)
 		if err != nil {
-			log.Fatalln("failed to generate embeddings", err)
+			log.Fatalln("failed to match documents for query", err)
 		}
 
-		if res != nil && len(res.Data) > 0 {
-			matchedDocs, err := supabase.InvokeMatchFunction(supabaseClient, constants.MatchDocumentsFunctionName, res.Data[0].Embedding, 1)
-			if err != nil {
-				log.Fatalln("failed to match documents for query", err)
-			}
-
-			if len(matchedDocs) != 1 {
-				log.Fatalln("invalid number of matching docs found")
-			}
-
-			messages := []openai.ChatCompletionMessageParamUnion{
-				{
-					OfSystem: &openai.ChatCompletionSystemMessageParam{
-						Content: openai.ChatCompletionSystemMessageParamContentUnion{
-							OfString: openai.String(PodcastsSystemMessage),
-						},
-					},
-				},
-			}
-
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String(fmt.Sprintf(UserMessageTmpl, matchedDocs[0].Content, query)),
-					},
-				},
-			})
+		answer := answerFromContext(
+			ctx,
+			openaiClient,
+			PodcastsSystemMessage,
+			fmt.Sprintf(UserMessageTmpl, grounding.BuildContext(matchedDocs), query),
+			query,
+			matchedDocs,
+			verify)
 
-			chatResp, err := openaiClient.Chat.Completions.New(
-				ctx,
-				openai.ChatCompletionNewParams{
-					Messages:         messages,
-					Model:            openai.ChatModelGPT4,
-					Temperature:      param.NewOpt(Temperature),
-					PresencePenalty:  param.NewOpt(PresencePenalty),
-					FrequencyPenalty: param.NewOpt(FrequencyPenalty),
-				})
-			if err != nil {
-				log.Fatalln("failed to generate podcast response", err)
-			}
-
-			log.Println(chatResp.Choices[0].Message.Content)
-		} else {
-			log.Fatalln("failed to generate embeddings for query", err)
-		}
+		writeAnswer(answer, format)
 
 	case "chunk-n-insert-movies":
 		// go run main.go -action=chunk-n-insert-movies
+		// go run main.go -action=chunk-n-insert-movies -chunking=record
 
-		log.Println("chunking movie details....")
-		chunks, err := langchain.SplitDocuments(SpaceSplitter, constants.Movies)
+		log.Printf("chunking movie details with %s strategy....\n", chunkOpts.Strategy)
+		chunks, err := langchain.ChunkDocument(constants.Movies, chunkOpts)
 		if err != nil {
 			log.Fatalln("failed to split documents", err)
 		}
 		log.Println("chunking movie details finished....")
 
-		log.Println("fetching existing movie embeddings....")
-		existingMovies := fetchExistingRows(supabaseClient, constants.MoviesTblName)
-		log.Println("fetching existing movie embeddings finished....")
+		checkDimensions(constants.MoviesTblName)
 
-		log.Println("processing movie chunks....")
-		for _, ch := range chunks {
-			if _, ok := existingMovies[ch]; ok {
-				continue
-			}
+		log.Println("syncing movie chunks....")
+		status, err := ingest.Sync(ctx, supabaseClient, constants.MoviesTblName, chunkRows(chunks), ingestEmbed(emb))
+		if err != nil {
+			log.Fatalln("failed to sync movie embeddings", err)
+		}
 
-			movieVector := getEmbeddings(ctx, openaiClient, []string{ch})
-			log.Printf("generating movie chunk (%s) embedding finished....\n", movieVector[0].Content)
+		log.Printf("new: %d, unchanged: %d, updated: %d, moved: %d, deleted: %d, duplicates: %d\n", status.New, status.Unchanged, status.Updated, status.Moved, status.Orphaned, status.Duplicates)
 
-			res, err := supabase.InsertDocument(constants.MoviesTblName, supabaseClient, movieVector[0])
-			if err != nil {
-				log.Fatalf("failed to insert embeddings for: '%s'\n: %v", movieVector[0].Content, err)
-			}
+	case "chunk-preview":
+		// go run main.go -action=chunk-preview
+		// go run main.go -action=chunk-preview -chunking=sentence -chunk-size=400
+		// go run main.go -action=chunk-preview -chunking=token -chunk-size=120 -chunk-overlap=20
+
+		chunks, err := langchain.ChunkDocument(constants.Movies, chunkOpts)
+		if err != nil {
+			log.Fatalln("failed to split documents", err)
+		}
 
-			log.Printf("inserting (%s) embeddings finished\n...", movieVector[0].Content)
-			log.Printf("len of docs: %d\n", len(res))
+		for _, ch := range chunks {
+			fmt.Printf("[%s #%d] (%d chars)\n%s\n\n", ch.ParentID, ch.Index, len(ch.Content), ch.Content)
 		}
 
+		fmt.Printf("%d chunks with %s strategy\n", len(chunks), chunkOpts.Strategy)
+
 	case "query-movie":
 		// go run main.go -action=query-movie -query="Which movie can I take my child to?" -matches=3
 		// go run main.go -action=query-movie -query="I feel like having a good laugh"
@@ -253,129 +378,275 @@ func main() {
 			log.Fatalln("query cannot be empty for semantic search & chat")
 		}
 
-		res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-			Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: openai.String(query),
-			},
+		checkDimensions(constants.MoviesTblName)
+
+		retriever := retrieval.NewRetriever(emb, supabaseClient, retrieval.Config{
+			MatchFunctionName:   constants.MatchMoviesFunctionName,
+			KwMatchFunctionName: constants.KwMatchMoviesFunctionName,
+			MatchThreshold:      threshold,
+			Hybrid:              hybrid,
+			CandidatePool:       candidates,
+			Reranker:            reranker,
 		})
+
+		matchedDocs, err := retriever.Retrieve(ctx, query, matches)
 		if err != nil {
-			log.Fatalln("failed to generate embeddings", err)
+			log.Fatalln("failed to match movies for query", err)
 		}
 
-		if res != nil && len(res.Data) > 0 {
-			matchedDocs, err := supabase.InvokeMatchFunction(supabaseClient, constants.MatchMoviesFunctionName, res.Data[0].Embedding, matches)
+		answer := answerFromContext(
+			ctx,
+			openaiClient,
+			MoviesSystemMessage,
+			fmt.Sprintf(UserMessageMovieSearchTmpl, grounding.BuildContext(matchedDocs), query, matches),
+			query,
+			matchedDocs,
+			verify)
+
+		writeAnswer(answer, format)
+
+	case "status":
+		// go run main.go -action=status
+		// go run main.go -action=status -chunking=record -format=json
+
+		chunks, err := langchain.ChunkDocument(constants.Movies, chunkOpts)
+		if err != nil {
+			log.Fatalln("failed to split documents", err)
+		}
+
+		podcastChunks, err := chunkPodcasts(chunkOpts)
+		if err != nil {
+			log.Fatalln("failed to split podcasts", err)
+		}
+
+		statuses := make([]ingest.Status, 0)
+		for table, rows := range map[string][]ingest.Row{
+			constants.DocumentsTblName: chunkRows(podcastChunks),
+			constants.MoviesTblName:    chunkRows(chunks),
+		} {
+			plan, err := ingest.Diff(supabaseClient, table, rows)
 			if err != nil {
-				log.Fatalln("failed to match movies for query", err)
+				log.Fatalln("failed to compare rows", err)
 			}
 
-			if len(matchedDocs) < matches {
-				log.Fatalln("invalid number of matching movies found")
-			}
+			statuses = append(statuses, plan.Status(table))
+		}
 
-			combinedMatchResult := ""
-			for _, md := range matchedDocs {
-				combinedMatchResult = fmt.Sprintf("%s\n%s", combinedMatchResult, md.Content)
-			}
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Table < statuses[j].Table
+		})
 
-			messages := []openai.ChatCompletionMessageParamUnion{
-				{
-					OfSystem: &openai.ChatCompletionSystemMessageParam{
-						Content: openai.ChatCompletionSystemMessageParamContentUnion{
-							OfString: openai.String(MoviesSystemMessage),
-						},
-					},
-				},
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(statuses); err != nil {
+				log.Fatalln("failed to write status", err)
+			}
+		} else {
+			for _, st := range statuses {
+				fmt.Printf("%s: %d new, %d unchanged, %d updated, %d moved, %d orphaned, %d duplicates\n", st.Table, st.New, st.Unchanged, st.Updated, st.Moved, st.Orphaned, st.Duplicates)
 			}
+		}
 
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String(fmt.Sprintf(UserMessageMovieSearchTmpl, combinedMatchResult, query, matches)),
-					},
-				},
-			})
+	case "eval-retrieval":
+		// go run main.go -action=eval-retrieval -eval-set=data/movies_eval.json
+		// go run main.go -action=eval-retrieval -eval-set=data/movies_eval.json -hybrid -thresholds=0.7,0.8 -ks=1,3
+		// go run main.go -action=eval-retrieval -eval-set=data/movies_eval.json -format=json > before.json
 
-			chatResp, err := openaiClient.Chat.Completions.New(
-				ctx,
-				openai.ChatCompletionNewParams{
-					Messages:         messages,
-					Model:            openai.ChatModelGPT4,
-					Temperature:      param.NewOpt(Temperature),
-					PresencePenalty:  param.NewOpt(PresencePenalty),
-					FrequencyPenalty: param.NewOpt(FrequencyPenalty),
-				})
-			if err != nil {
-				log.Fatalln("failed to generate movies response", err)
-			}
+		if len(strings.TrimSpace(evalSet)) == 0 {
+			log.Fatalln("eval-set cannot be empty for retrieval evaluation")
+		}
+
+		ds, err := evaluation.LoadDataset(evalSet)
+		if err != nil {
+			log.Fatalln("failed to load eval set", err)
+		}
+
+		cfg := retrieval.Config{
+			MatchFunctionName:   constants.MatchMoviesFunctionName,
+			KwMatchFunctionName: constants.KwMatchMoviesFunctionName,
+			Hybrid:              hybrid,
+			CandidatePool:       candidates,
+			Reranker:            reranker,
+		}
+		table := constants.MoviesTblName
+		if ds.Target == evaluation.DocumentsTarget {
+			cfg.MatchFunctionName = constants.MatchDocumentsFunctionName
+			cfg.KwMatchFunctionName = constants.KwMatchDocumentsFunctionName
+			table = constants.DocumentsTblName
+		}
+
+		checkDimensions(table)
+
+		report, err := evaluation.Run(
+			ctx,
+			retrieval.NewRetriever(emb, supabaseClient, cfg),
+			ds,
+			evaluation.Options{
+				Thresholds: thresholds,
+				Ks:         ks,
+				Hybrid:     hybrid,
+				Rerank:     rerank,
+			})
+		if err != nil {
+			log.Fatalln("failed to evaluate retrieval", err)
+		}
 
-			log.Println(chatResp.Choices[0].Message.Content)
+		if format == "json" {
+			err = report.WriteJSON(os.Stdout)
 		} else {
-			log.Fatalln("failed to generate embeddings for query", err)
+			err = report.WriteText(os.Stdout)
+		}
+		if err != nil {
+			log.Fatalln("failed to write eval report", err)
 		}
 	}
 
 }
 
-func fetchExistingRows(
-	supabaseClient *supa.Client,
-	tableName string) map[string]any {
-	allDocs, err := supabase.ReadDocuments(tableName, supabaseClient)
-	if err != nil {
-		log.Fatalf("failed to fetch embeddings from: '%s'\n: %v", tableName, err)
+func parseFloats(s string) ([]float64, error) {
+	values := make([]float64, 0)
+
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
 	}
 
-	allDocsMap := make(map[string]any)
-	for _, d := range allDocs {
-		allDocsMap[d.Content] = nil
+	return values, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	values := make([]int, 0)
+
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+
+		if v <= 0 {
+			return nil, fmt.Errorf("must be positive: %d", v)
+		}
+
+		values = append(values, v)
 	}
 
-	return allDocsMap
+	return values, nil
 }
 
-func getEmbeddings(
+func answerFromContext(
 	ctx context.Context,
 	openaiClient openai.Client,
-	sentences []string) []models.Vector {
-	vectors := make([]models.Vector, 0)
-
-	for _, s := range sentences {
-		res, err := openaiClient.Embeddings.New(ctx, openai.EmbeddingNewParams{
-			Model: "text-embedding-ada-002", // Default length of 1536 embeddings of array
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: openai.String(s),
+	systemMessage string,
+	userMessage string,
+	query string,
+	matchedDocs []retrieval.Candidate,
+	verify bool,
+) grounding.Answer {
+	if len(matchedDocs) == 0 {
+		return grounding.Abstain(query)
+	}
+
+	messages := []openai.ChatCompletionMessageParamUnion{
+		{
+			OfSystem: &openai.ChatCompletionSystemMessageParam{
+				Content: openai.ChatCompletionSystemMessageParamContentUnion{
+					OfString: openai.String(systemMessage + grounding.CitationInstruction),
+				},
+			},
+		},
+		{
+			OfUser: &openai.ChatCompletionUserMessageParam{
+				Content: openai.ChatCompletionUserMessageParamContentUnion{
+					OfString: openai.String(userMessage),
+				},
 			},
+		},
+	}
+
+	chatResp, err := openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages:         messages,
+			Model:            openai.ChatModelGPT4,
+			Temperature:      param.NewOpt(Temperature),
+			PresencePenalty:  param.NewOpt(PresencePenalty),
+			FrequencyPenalty: param.NewOpt(FrequencyPenalty),
 		})
+	if err != nil {
+		log.Fatalln("failed to generate response", err)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		log.Fatalln("failed to generate response: empty chat response")
+	}
+
+	answer := grounding.NewAnswer(query, chatResp.Choices[0].Message.Content, matchedDocs)
+
+	if verify && !answer.Abstained {
+		unsupported, err := grounding.NewVerifier(openaiClient).Unsupported(ctx, answer.Answer, matchedDocs)
 		if err != nil {
-			log.Fatalln("failed to generate embeddings", err)
+			log.Println("failed to verify answer against context:", err)
 		}
 
-		vectors = append(vectors, models.Vector{
-			Content:   s,
-			Embedding: res.Data[0].Embedding,
-		})
+		answer.Unsupported = unsupported
 	}
 
-	return vectors
+	return answer
 }
 
-func insertRowIfNotPresent(
-	supabaseClient *supa.Client,
-	tableName string,
-	v models.Vector,
-) {
-	res, err := supabase.ReadDocumentByContent(tableName, supabaseClient, v.Content)
+func writeAnswer(answer grounding.Answer, format string) {
+	var err error
+	if format == "json" {
+		err = answer.WriteJSON(os.Stdout)
+	} else {
+		err = answer.WriteText(os.Stdout)
+	}
+
 	if err != nil {
-		log.Fatalf("failed to find embeddings for: '%s'\n: %v", v.Content, err)
+		log.Fatalln("failed to write answer", err)
+	}
+}
+
+// chunkPodcasts splits every podcast on its own, so that no chunk mixes two of them.
+func chunkPodcasts(opts langchain.ChunkOptions) ([]langchain.Chunk, error) {
+	chunks := make([]langchain.Chunk, 0, len(constants.Podcasts))
+	for _, p := range constants.Podcasts {
+		podcastChunks, err := langchain.ChunkDocument(p, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, podcastChunks...)
 	}
 
-	found := len(res) > 0
-	if !found {
-		res, err := supabase.InsertDocument(tableName, supabaseClient, v)
+	return chunks, nil
+}
+
+func chunkRows(chunks []langchain.Chunk) []ingest.Row {
+	rows := make([]ingest.Row, 0, len(chunks))
+	for _, ch := range chunks {
+		rows = append(rows, ingest.Row{
+			ParentID:   ch.ParentID,
+			ChunkIndex: ch.Index,
+			Content:    ch.Content,
+		})
+	}
+
+	return rows
+}
+
+func ingestEmbed(emb embedder.Embedder) ingest.Embed {
+	return func(ctx context.Context, content string) ([]float64, error) {
+		embeddings, err := emb.Embed(ctx, []string{content})
 		if err != nil {
-			log.Fatalf("failed to insert embeddings for: '%s'\n: %v", v.Content, err)
+			return nil, err
 		}
 
-		log.Printf("len of docs: %d\n", len(res))
+		return embeddings[0], nil
 	}
 }
@@ -1,6 +1,10 @@
 package db
 
 type Document struct {
-	Content   string `json:"content"`
-	Embedding string `json:"embedding"`
+	ID          int    `json:"id,omitempty"`
+	ParentID    string `json:"parent_id,omitempty"`
+	ChunkIndex  int    `json:"chunk_index,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+	Content     string `json:"content"`
+	Embedding   string `json:"embedding"`
 }
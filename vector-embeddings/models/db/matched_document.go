@@ -2,6 +2,7 @@ package db
 
 type MatchedDocument struct {
 	ID         int     `json:"id"`
+	ParentID   string  `json:"parent_id"`
 	Content    string  `json:"content"`
 	Similarity float64 `json:"similarity"`
 }
@@ -1,6 +1,9 @@
 package models
 
 type Vector struct {
-	Content   string    `json:"content"`
-	Embedding []float64 `json:"embedding"`
+	Content     string    `json:"content"`
+	Embedding   []float64 `json:"embedding"`
+	ParentID    string    `json:"parent_id,omitempty"`
+	ChunkIndex  int       `json:"chunk_index,omitempty"`
+	ContentHash string    `json:"content_hash,omitempty"`
 }
@@ -0,0 +1,8 @@
+-- Add chunk lineage columns to tables created before chunking strategies were supported
+alter table documents
+  add column if not exists parent_id text,
+  add column if not exists chunk_index int default 0;
+
+alter table movies
+  add column if not exists parent_id text,
+  add column if not exists chunk_index int default 0;
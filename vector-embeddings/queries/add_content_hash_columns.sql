@@ -0,0 +1,7 @@
+-- Add content hash columns to tables created before upserts were supported.
+-- Existing rows have no hash yet, the next insert-docs / chunk-n-insert-movies run replaces them.
+alter table documents
+  add column if not exists content_hash text unique;
+
+alter table movies
+  add column if not exists content_hash text unique;
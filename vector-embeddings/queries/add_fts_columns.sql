@@ -0,0 +1,10 @@
+-- Add keyword search columns to tables created before hybrid search was supported
+alter table documents
+  add column if not exists fts tsvector generated always as (to_tsvector('english', content)) stored;
+
+create index if not exists documents_fts_idx on documents using gin (fts);
+
+alter table movies
+  add column if not exists fts tsvector generated always as (to_tsvector('english', content)) stored;
+
+create index if not exists movies_fts_idx on movies using gin (fts);
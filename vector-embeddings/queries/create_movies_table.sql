@@ -1,6 +1,12 @@
 -- Create a table to store your movies
 create table movies (
   id bigserial primary key,
+  parent_id text, -- record the chunk was split from
+  chunk_index int default 0, -- position of the chunk within its record
   content text, -- corresponds to the "text chunk"
-  embedding vector(1536) -- 1536 works for OpenAI embeddings
-);
\ No newline at end of file
+  content_hash text unique, -- sha256 of content, used to skip unchanged rows
+  embedding vector(1536), -- 1536 works for OpenAI embeddings
+  fts tsvector generated always as (to_tsvector('english', content)) stored -- used for keyword search
+);
+
+create index movies_fts_idx on movies using gin (fts);
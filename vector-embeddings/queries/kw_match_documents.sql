@@ -0,0 +1,27 @@
+-- Create a function to keyword search for documents
+-- Query terms are OR-ed so that natural language questions still match partially
+drop function if exists kw_match_documents;
+
+create or replace function kw_match_documents (
+  query_text text,
+  match_count int
+)
+returns table (
+  id bigint,
+  parent_id text,
+  content text,
+  similarity float
+)
+language sql stable
+as $$
+  select
+    documents.id,
+    documents.parent_id,
+    documents.content,
+    ts_rank_cd(documents.fts, query) as similarity
+  from documents,
+    to_tsquery('english', replace(plainto_tsquery('english', query_text)::text, '&', '|')) query
+  where documents.fts @@ query
+  order by similarity desc
+  limit match_count;
+$$;
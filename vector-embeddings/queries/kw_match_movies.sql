@@ -0,0 +1,27 @@
+-- Create a function to keyword search for movies
+-- Query terms are OR-ed so that natural language questions still match partially
+drop function if exists kw_match_movies;
+
+create or replace function kw_match_movies (
+  query_text text,
+  match_count int
+)
+returns table (
+  id bigint,
+  parent_id text,
+  content text,
+  similarity float
+)
+language sql stable
+as $$
+  select
+    movies.id,
+    movies.parent_id,
+    movies.content,
+    ts_rank_cd(movies.fts, query) as similarity
+  from movies,
+    to_tsquery('english', replace(plainto_tsquery('english', query_text)::text, '&', '|')) query
+  where movies.fts @@ query
+  order by similarity desc
+  limit match_count;
+$$;
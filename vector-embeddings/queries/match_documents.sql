@@ -1,4 +1,6 @@
 -- Create a function to search for documents
+drop function if exists match_documents;
+
 create or replace function match_documents (
   query_embedding vector(1536),
   match_threshold float,
@@ -6,6 +8,7 @@ create or replace function match_documents (
 )
 returns table (
   id bigint,
+  parent_id text,
   content text,
   similarity float
 )
@@ -13,6 +16,7 @@ language sql stable
 as $$
   select
     documents.id,
+    documents.parent_id,
     documents.content,
     1 - (documents.embedding <=> query_embedding) as similarity
   from documents
@@ -1,4 +1,6 @@
 -- Create a function to search for movies
+drop function if exists match_movies;
+
 create or replace function match_movies (
   query_embedding vector(1536),
   match_threshold float,
@@ -6,6 +8,7 @@ create or replace function match_movies (
 )
 returns table (
   id bigint,
+  parent_id text,
   content text,
   similarity float
 )
@@ -13,6 +16,7 @@ language sql stable
 as $$
   select
     movies.id,
+    movies.parent_id,
     movies.content,
     1 - (movies.embedding <=> query_embedding) as similarity
   from movies
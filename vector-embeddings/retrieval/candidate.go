@@ -0,0 +1,11 @@
+package retrieval
+
+type Candidate struct {
+	ID          int     `json:"id"`
+	ParentID    string  `json:"parentId,omitempty"`
+	Content     string  `json:"content"`
+	Similarity  float64 `json:"similarity"`
+	VectorRank  int     `json:"vectorRank,omitempty"`
+	KeywordRank int     `json:"keywordRank,omitempty"`
+	Score       float64 `json:"score"`
+}
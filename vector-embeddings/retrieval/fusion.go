@@ -0,0 +1,54 @@
+package retrieval
+
+import (
+	"sort"
+
+	"vector-embeddings/models/db"
+)
+
+// RRFConstant dampens the weight of the top ranks, 60 is the value used in the original paper.
+// https://plg.uwaterloo.ca/~gvcormac/cormacksigir09-rrf.pdf
+const RRFConstant = 60.0
+
+func ReciprocalRankFusion(
+	vectorMatches []db.MatchedDocument,
+	keywordMatches []db.MatchedDocument,
+) []Candidate {
+	byID := make(map[int]*Candidate)
+	order := make([]int, 0)
+
+	lookup := func(md db.MatchedDocument) *Candidate {
+		c, ok := byID[md.ID]
+		if !ok {
+			c = &Candidate{ID: md.ID, ParentID: md.ParentID, Content: md.Content}
+			byID[md.ID] = c
+			order = append(order, md.ID)
+		}
+
+		return c
+	}
+
+	for i, md := range vectorMatches {
+		c := lookup(md)
+		c.Similarity = md.Similarity
+		c.VectorRank = i + 1
+		c.Score += 1 / (RRFConstant + float64(i+1))
+	}
+
+	for i, md := range keywordMatches {
+		c := lookup(md)
+		c.KeywordRank = i + 1
+		c.Score += 1 / (RRFConstant + float64(i+1))
+	}
+
+	fused := make([]Candidate, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, *byID[id])
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+
+	return fused
+}
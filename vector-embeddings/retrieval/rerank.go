@@ -0,0 +1,114 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/pkg/errors"
+)
+
+const RerankSystemMessage = `You are a search relevance judge. You will be given a question and a numbered list of documents. Score how well each document helps answer the question on a scale from 0 (irrelevant) to 10 (directly answers it). Reply only with JSON in the form {"scores": [{"id": <document id>, "score": <0-10>}]} and include every document.`
+
+type Reranker interface {
+	Rerank(ctx context.Context, query string, candidates []Candidate) ([]Candidate, error)
+}
+
+type LLMReranker struct {
+	openaiClient openai.Client
+}
+
+func NewLLMReranker(openaiClient openai.Client) *LLMReranker {
+	return &LLMReranker{openaiClient: openaiClient}
+}
+
+type rerankScores struct {
+	Scores []struct {
+		ID    int     `json:"id"`
+		Score float64 `json:"score"`
+	} `json:"scores"`
+}
+
+func (r *LLMReranker) Rerank(
+	ctx context.Context,
+	query string,
+	candidates []Candidate,
+) ([]Candidate, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	var sb strings.Builder
+	for _, c := range candidates {
+		sb.WriteString(fmt.Sprintf("Document %d: %s\n", c.ID, c.Content))
+	}
+
+	chatResp, err := r.openaiClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				{
+					OfSystem: &openai.ChatCompletionSystemMessageParam{
+						Content: openai.ChatCompletionSystemMessageParamContentUnion{
+							OfString: openai.String(RerankSystemMessage),
+						},
+					},
+				},
+				{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfString: openai.String(fmt.Sprintf("Question: %s\n\nDocuments:\n%s", query, sb.String())),
+						},
+					},
+				},
+			},
+			Model:       openai.ChatModelGPT4o,
+			Temperature: param.NewOpt(0.0),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &openai.ResponseFormatJSONObjectParam{},
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rerank candidates")
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, errors.New("empty rerank response")
+	}
+
+	var scores rerankScores
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &scores); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rerank response")
+	}
+
+	scoreByID := make(map[int]float64)
+	for _, s := range scores.Scores {
+		scoreByID[s.ID] = s.Score
+	}
+
+	reranked := make([]Candidate, len(candidates))
+	copy(reranked, candidates)
+
+	// candidates the model skipped keep their fused order, behind every scored one
+	sort.SliceStable(reranked, func(i, j int) bool {
+		si, iok := scoreByID[reranked[i].ID]
+		sj, jok := scoreByID[reranked[j].ID]
+		if iok != jok {
+			return iok
+		}
+
+		return si > sj
+	})
+
+	for i := range reranked {
+		if s, ok := scoreByID[reranked[i].ID]; ok {
+			reranked[i].Score = s
+		}
+	}
+
+	return reranked, nil
+}
@@ -0,0 +1,124 @@
+package retrieval
+
+import (
+	"context"
+
+	"vector-embeddings/models/db"
+	"vector-embeddings/supabase"
+
+	"embedder"
+
+	supa "github.com/nedpals/supabase-go"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	MatchFunctionName   string
+	KwMatchFunctionName string
+	// MatchThreshold is the minimum cosine similarity of a vector match.
+	MatchThreshold float64
+	// Hybrid fuses keyword search results with vector search results.
+	Hybrid bool
+	// CandidatePool is the number of results fetched from each search before fusion and reranking.
+	CandidatePool int
+	// Reranker is optional, when nil the fused order is kept.
+	Reranker Reranker
+}
+
+type Retriever struct {
+	embedder       embedder.Embedder
+	supabaseClient *supa.Client
+	cfg            Config
+}
+
+func NewRetriever(
+	emb embedder.Embedder,
+	supabaseClient *supa.Client,
+	cfg Config,
+) *Retriever {
+	return &Retriever{
+		embedder:       emb,
+		supabaseClient: supabaseClient,
+		cfg:            cfg,
+	}
+}
+
+func (r *Retriever) Retrieve(
+	ctx context.Context,
+	query string,
+	numMatches int,
+) ([]Candidate, error) {
+	embedding, err := r.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Search(ctx, query, embedding, numMatches, r.cfg.MatchThreshold)
+}
+
+func (r *Retriever) Embed(
+	ctx context.Context,
+	query string,
+) ([]float64, error) {
+	embeddings, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to embed query")
+	}
+
+	return embeddings[0], nil
+}
+
+// Search runs retrieval for an already embedded query, so that callers sweeping
+// thresholds or match counts only pay for the embedding once.
+func (r *Retriever) Search(
+	ctx context.Context,
+	query string,
+	embedding []float64,
+	numMatches int,
+	threshold float64,
+) ([]Candidate, error) {
+	poolSize := r.PoolSize(numMatches)
+
+	vectorMatches, err := supabase.InvokeMatchFunction(r.supabaseClient, r.cfg.MatchFunctionName, embedding, poolSize, threshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to match documents for query")
+	}
+
+	var keywordMatches []db.MatchedDocument
+	if r.cfg.Hybrid {
+		keywordMatches, err = supabase.InvokeKeywordMatchFunction(r.supabaseClient, r.cfg.KwMatchFunctionName, query, poolSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to keyword match documents for query")
+		}
+	}
+
+	candidates := ReciprocalRankFusion(vectorMatches, keywordMatches)
+	if !r.cfg.Hybrid {
+		for i := range candidates {
+			candidates[i].Score = candidates[i].Similarity
+		}
+	}
+
+	if r.cfg.Reranker != nil {
+		candidates, err = r.cfg.Reranker.Rerank(ctx, query, candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(candidates) > numMatches {
+		candidates = candidates[:numMatches]
+	}
+
+	return candidates, nil
+}
+
+// PoolSize is the number of results Search fetches from each search for numMatches.
+// Searches with the same pool size return prefixes of the same ranking.
+func (r *Retriever) PoolSize(numMatches int) int {
+	if (r.cfg.Hybrid || r.cfg.Reranker != nil) && r.cfg.CandidatePool > numMatches {
+		return r.cfg.CandidatePool
+	}
+
+	return numMatches
+}
@@ -1,6 +1,8 @@
 package supabase
 
 import (
+	"strconv"
+
 	"vector-embeddings/constants"
 	"vector-embeddings/models"
 	"vector-embeddings/models/db"
@@ -61,18 +63,100 @@ func ReadDocuments(
 	return results, nil
 }
 
+// ReadDocumentKeys reads every row without its content or embedding, page by page,
+// since PostgREST caps the number of rows returned by a single request.
+func ReadDocumentKeys(
+	tableName string,
+	dbClient *supa.Client,
+) ([]db.Document, error) {
+	results := make([]db.Document, 0)
+
+	for offset := 0; ; offset += constants.ReadPageSize {
+		var page []db.Document
+
+		err := dbClient.
+			DB.
+			From(tableName).
+			Select(constants.KeyColumnNames).
+			OrderBy("id", "asc").
+			LimitWithOffset(constants.ReadPageSize, offset).
+			Execute(&page)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, page...)
+
+		if len(page) < constants.ReadPageSize {
+			return results, nil
+		}
+	}
+}
+
+func UpdateDocument(
+	tableName string,
+	dbClient *supa.Client,
+	id int,
+	doc models.Vector,
+) ([]db.Document, error) {
+	var results []db.Document
+
+	err := dbClient.DB.From(tableName).Update(doc).Eq("id", strconv.Itoa(id)).Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// UpdateDocumentKey changes the parent ID and chunk index of a row, keeping its embedding.
+func UpdateDocumentKey(
+	tableName string,
+	dbClient *supa.Client,
+	id int,
+	parentID string,
+	chunkIndex int,
+) error {
+	var results []db.Document
+
+	return dbClient.DB.From(tableName).Update(map[string]any{
+		"parent_id":   parentID,
+		"chunk_index": chunkIndex,
+	}).Eq("id", strconv.Itoa(id)).Execute(&results)
+}
+
+func DeleteDocuments(
+	tableName string,
+	dbClient *supa.Client,
+	ids []int,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.Itoa(id))
+	}
+
+	var results []db.Document
+
+	return dbClient.DB.From(tableName).Delete().In("id", values).Execute(&results)
+}
+
 // https://supabase.com/docs/guides/ai/vector-columns#querying-a-vector--embedding
 func InvokeMatchFunction(
 	dbClient *supa.Client,
 	functionName string,
 	embedding []float64,
 	numMatches int,
+	threshold float64,
 ) ([]db.MatchedDocument, error) {
 	var results []db.MatchedDocument
 
 	err := dbClient.DB.Rpc(functionName, map[string]any{
 		"query_embedding": embedding,
-		"match_threshold": 0.50,
+		"match_threshold": threshold,
 		"match_count":     numMatches,
 	}).Execute(&results)
 	if err != nil {
@@ -81,3 +165,44 @@ func InvokeMatchFunction(
 
 	return results, nil
 }
+
+// https://supabase.com/docs/guides/database/full-text-search
+func InvokeKeywordMatchFunction(
+	dbClient *supa.Client,
+	functionName string,
+	query string,
+	numMatches int,
+) ([]db.MatchedDocument, error) {
+	var results []db.MatchedDocument
+
+	err := dbClient.DB.Rpc(functionName, map[string]any{
+		"query_text":  query,
+		"match_count": numMatches,
+	}).Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ReadEmbeddingDimensions returns the size of the table's embedding column, 0 when it isn't declared.
+func ReadEmbeddingDimensions(
+	dbClient *supa.Client,
+	tableName string,
+) (int, error) {
+	var dimensions *int
+
+	err := dbClient.DB.Rpc(constants.EmbeddingDimensionsFunctionName, map[string]any{
+		"table_name": tableName,
+	}).Execute(&dimensions)
+	if err != nil {
+		return 0, err
+	}
+
+	if dimensions == nil {
+		return 0, nil
+	}
+
+	return *dimensions, nil
+}